@@ -0,0 +1,140 @@
+package xrmcontroller
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	ErrIPForbidden = errors.New("access denied for address")
+
+	// readOnlyRoutes is a routes without side effects (path.Match syntax), checked with read ACL, other routes checked with write ACL
+	readOnlyRoutes = []string{
+		"/metrics",
+		"/status",
+		"/audit",
+		"/audit/verify",
+		"/jobs",
+		"/jobs/*",
+		"/secrets",
+		"/webhooks/deliveries",
+		"/ovirt/failover/*/approval",
+		"/ovirt/*/*/result",
+		"/ovirt/logs/*",
+	}
+)
+
+// ParseCIDRs parse networks list (CIDR or single address)
+func ParseCIDRs(addrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr == "" {
+			// skip empty
+			continue
+		}
+		if strings.Contains(addr, "/") {
+			_, ipNet, err := net.ParseCIDR(addr)
+			if err != nil {
+				return nil, err
+			}
+			nets = append(nets, ipNet)
+		} else {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: addr}
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				nets = append(nets, &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})
+			} else {
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+			}
+		}
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IPACL is an address access list. Deny list is checked first, empty allow list allow any address
+type IPACL struct {
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+}
+
+func (a IPACL) Allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if containsIP(a.Deny, ip) {
+		return false
+	}
+	return len(a.Allow) == 0 || containsIP(a.Allow, ip)
+}
+
+// clientIP return client address. If request is received from trusted proxy, address is taken from X-Forwarded-For
+// (the last address, not owned by trusted proxies)
+func clientIP(c *fiber.Ctx, trustedProxies []*net.IPNet) net.IP {
+	ip := c.Context().RemoteIP()
+	if len(trustedProxies) == 0 || !containsIP(trustedProxies, ip) {
+		return ip
+	}
+	forwarded := c.Get(fiber.HeaderXForwardedFor)
+	for forwarded != "" {
+		var addr string
+		if pos := strings.LastIndexByte(forwarded, ','); pos == -1 {
+			addr = forwarded
+			forwarded = ""
+		} else {
+			addr = forwarded[pos+1:]
+			forwarded = forwarded[:pos]
+		}
+		addr = strings.TrimSpace(addr)
+		fwdIP := net.ParseIP(addr)
+		if fwdIP == nil {
+			// broken header, stop on last valid address
+			break
+		}
+		ip = fwdIP
+		if !containsIP(trustedProxies, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func isReadOnlyRoute(p string) bool {
+	for _, route := range readOnlyRoutes {
+		if ok, _ := path.Match(route, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ipACL check client address with read or write ACL (selected by route)
+func ipACL(c *fiber.Ctx) error {
+	ip := clientIP(c, Cfg.TrustedProxies)
+	c.Locals("client_ip", ip.String())
+
+	acl := &Cfg.WriteACL
+	if isReadOnlyRoute(c.Path()) {
+		acl = &Cfg.ReadACL
+	}
+	if !acl.Allowed(ip) {
+		return fiber.NewError(http.StatusForbidden, ErrIPForbidden.Error()+" "+ip.String())
+	}
+
+	return c.Next()
+}
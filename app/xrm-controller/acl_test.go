@@ -0,0 +1,89 @@
+package xrmcontroller
+
+import (
+	"io"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIPACL_Allowed(t *testing.T) {
+	allow, err := ParseCIDRs([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deny, err := ParseCIDRs([]string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl := IPACL{Allow: allow, Deny: deny}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "10.0.0.1", want: true},
+		{ip: "10.1.0.1", want: false},
+		{ip: "192.168.1.1", want: true},
+		{ip: "192.168.1.2", want: false},
+		{ip: "fd00::1", want: true},
+		{ip: "::1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := acl.Allowed(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("IPACL.Allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !(IPACL{Deny: deny}).Allowed(net.ParseIP("127.0.0.1")) {
+		t.Errorf("IPACL.Allowed() with empty allow list must allow")
+	}
+
+	if _, err = ParseCIDRs([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("ParseCIDRs() must fail")
+	}
+	if _, err = ParseCIDRs([]string{"localhost"}); err == nil {
+		t.Errorf("ParseCIDRs() must fail")
+	}
+}
+
+func Test_clientIP(t *testing.T) {
+	// fasthttp test connection use 0.0.0.0 as remote address
+	proxies, _ := ParseCIDRs([]string{"0.0.0.0", "10.0.0.0/8"})
+	tests := []struct {
+		name      string
+		proxies   []*net.IPNet
+		forwarded string
+		want      string
+	}{
+		{name: "not trusted", forwarded: "192.168.1.1", want: "0.0.0.0"},
+		{name: "no header", proxies: proxies, want: "0.0.0.0"},
+		{name: "client", proxies: proxies, forwarded: "192.168.1.1", want: "192.168.1.1"},
+		{name: "proxies chain", proxies: proxies, forwarded: "192.168.1.2, 192.168.1.1, 10.0.0.2", want: "192.168.1.1"},
+		{name: "all trusted", proxies: proxies, forwarded: "10.0.0.1, 10.0.0.2", want: "10.0.0.1"},
+		{name: "broken", proxies: proxies, forwarded: "192.168.1.1, unknown", want: "0.0.0.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				return c.SendString(clientIP(c, tt.proxies).String())
+			})
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.forwarded != "" {
+				req.Header.Set(fiber.HeaderXForwardedFor, tt.forwarded)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if got := string(body); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
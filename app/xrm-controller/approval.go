@@ -0,0 +1,393 @@
+package xrmcontroller
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xrm-tech/xrm-controller/ovirt"
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+var (
+	ErrApprovalNotFound     = errors.New("approval request not found")
+	ErrApprovalExpired      = errors.New("approval request expired")
+	ErrApprovalPending      = errors.New("another approval request pending")
+	ErrApprovalSameUser     = errors.New("approval request must be resolved by another user")
+	ErrApprovalNotSupported = errors.New("approval mode is disabled")
+
+	// approval trail, stored in config dir
+	approvalLogFile = "approval.log"
+)
+
+type ApprovalStatus string
+
+const (
+	ApprovalPending  ApprovalStatus = "pending"
+	ApprovalApproved ApprovalStatus = "approved"
+	ApprovalRejected ApprovalStatus = "rejected"
+	ApprovalExpired  ApprovalStatus = "expired"
+	ApprovalStarted  ApprovalStatus = "started"
+	ApprovalSuccess  ApprovalStatus = "success"
+	ApprovalFailed   ApprovalStatus = "failed"
+)
+
+// Approval is a pending operation request, wait for approve by another user
+type Approval struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Operation   string         `json:"operation"`
+	Status      ApprovalStatus `json:"status"`
+	RequestedBy string         `json:"requested_by"`
+	RequestedAt time.Time      `json:"requested_at"`
+	Expires     time.Time      `json:"expires"`
+	ResolvedBy  string         `json:"resolved_by,omitempty"`
+	ResolvedAt  time.Time      `json:"resolved_at,omitempty"`
+}
+
+// ApprovalEvent is an approval trail record
+type ApprovalEvent struct {
+	Time      time.Time      `json:"time"`
+	ID        string         `json:"id"`
+	Operation string         `json:"operation"`
+	Status    ApprovalStatus `json:"status"`
+	Username  string         `json:"username"`
+	Message   string         `json:"message,omitempty"`
+}
+
+type approvals struct {
+	lock    sync.Mutex
+	pending map[string]*Approval // by config name
+}
+
+var approvalsPending = approvals{pending: make(map[string]*Approval)}
+
+func approvalID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func approvalConfigDir(name string) (string, error) {
+	if !ovirt.ValidateName(name) {
+		return "", ovirt.ErrNameInvalid
+	}
+	dir := path.Join(Cfg.OVirtStoreDir, name)
+	if !utils.DirExists(dir) {
+		return "", ovirt.ErrDirNotExist
+	}
+	return dir, nil
+}
+
+// approvalTrail append event to {config_dir}/approval.log
+func approvalTrail(dir string, a *Approval, status ApprovalStatus, username, msg string) error {
+	b, err := Encode(ApprovalEvent{
+		Time: time.Now().UTC(), ID: a.ID, Operation: a.Operation, Status: status, Username: username, Message: msg,
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path.Join(dir, approvalLogFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if _, err = f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// expire must be called under lock
+func (p *approvals) expire(dir, name string, now time.Time) {
+	if a, ok := p.pending[name]; ok && now.After(a.Expires) {
+		delete(p.pending, name)
+		a.Status = ApprovalExpired
+		_ = approvalTrail(dir, a, ApprovalExpired, "", "")
+	}
+}
+
+// terminateTrail append line end to approval trail, if last record is partially written (on crash)
+func terminateTrail(dir string) error {
+	f, err := os.OpenFile(path.Join(dir, approvalLogFile), os.O_RDWR, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil || st.Size() == 0 {
+		return err
+	}
+	b := make([]byte, 1)
+	if _, err = f.ReadAt(b, st.Size()-1); err != nil || b[0] == '\n' {
+		return err
+	}
+	_, err = f.WriteAt([]byte{'\n'}, st.Size())
+	return err
+}
+
+// lostApprovals return unresolved pending requests from approval trail (in trail order)
+func lostApprovals(dir string) ([]Approval, error) {
+	f, err := os.Open(path.Join(dir, approvalLogFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		order   []string
+		pending = make(map[string]Approval)
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e ApprovalEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// skip broken record (partially written on crash)
+			continue
+		}
+		switch e.Status {
+		case ApprovalPending:
+			order = append(order, e.ID)
+			pending[e.ID] = Approval{ID: e.ID, Operation: e.Operation, Status: ApprovalPending, RequestedBy: e.Username, RequestedAt: e.Time}
+		case ApprovalApproved, ApprovalRejected, ApprovalExpired:
+			delete(pending, e.ID)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	lost := make([]Approval, 0, len(pending))
+	for _, id := range order {
+		if a, ok := pending[id]; ok {
+			lost = append(lost, a)
+		}
+	}
+	return lost, nil
+}
+
+// ExpireLostApprovals expire pending requests, lost on controller restart (pending requests are not persisted),
+// must be called before server start, return expired requests
+func ExpireLostApprovals() ([]Approval, error) {
+	entries, err := os.ReadDir(Cfg.OVirtStoreDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var expired []Approval
+	for _, entry := range entries {
+		if !entry.IsDir() || !ovirt.ValidateName(entry.Name()) {
+			continue
+		}
+		dir := path.Join(Cfg.OVirtStoreDir, entry.Name())
+		lost, err := lostApprovals(dir)
+		if err != nil {
+			return expired, err
+		}
+		if len(lost) == 0 {
+			continue
+		}
+		if err = terminateTrail(dir); err != nil {
+			return expired, err
+		}
+		for i := range lost {
+			a := &lost[i]
+			a.Name = entry.Name()
+			a.Status = ApprovalExpired
+			if err = approvalTrail(dir, a, ApprovalExpired, "", "lost on controller restart"); err != nil {
+				return expired, err
+			}
+			expired = append(expired, *a)
+		}
+	}
+	return expired, nil
+}
+
+// Request create pending approval for operation
+func (p *approvals) Request(name, operation, username string) (Approval, error) {
+	dir, err := approvalConfigDir(name)
+	if err != nil {
+		return Approval{}, err
+	}
+	now := time.Now().UTC()
+	// stored after request, but fiber strings are reused
+	name = strings.Clone(name)
+	username = strings.Clone(username)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.expire(dir, name, now)
+	if a, ok := p.pending[name]; ok {
+		return *a, ErrApprovalPending
+	}
+
+	a := &Approval{
+		ID:          approvalID(),
+		Name:        name,
+		Operation:   operation,
+		Status:      ApprovalPending,
+		RequestedBy: username,
+		RequestedAt: now,
+		Expires:     now.Add(Cfg.ApprovalTimeout),
+	}
+	if err = approvalTrail(dir, a, ApprovalPending, username, ""); err != nil {
+		return Approval{}, err
+	}
+	p.pending[name] = a
+
+	return *a, nil
+}
+
+// Get return pending approval for config
+func (p *approvals) Get(name string) (Approval, error) {
+	dir, err := approvalConfigDir(name)
+	if err != nil {
+		return Approval{}, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.expire(dir, name, time.Now().UTC())
+	if a, ok := p.pending[name]; ok {
+		return *a, nil
+	}
+	return Approval{}, ErrApprovalNotFound
+}
+
+// Resolve approve or reject pending approval, approved request is removed from pending and must be started by caller
+func (p *approvals) Resolve(name, id, username string, approve bool) (Approval, error) {
+	dir, err := approvalConfigDir(name)
+	if err != nil {
+		return Approval{}, err
+	}
+	now := time.Now().UTC()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	a, ok := p.pending[name]
+	if !ok || a.ID != id {
+		return Approval{}, ErrApprovalNotFound
+	}
+	if now.After(a.Expires) {
+		p.expire(dir, name, now)
+		return *a, ErrApprovalExpired
+	}
+	if a.RequestedBy == username {
+		return *a, ErrApprovalSameUser
+	}
+
+	if approve {
+		a.Status = ApprovalApproved
+	} else {
+		a.Status = ApprovalRejected
+	}
+	a.ResolvedBy = username
+	a.ResolvedAt = now
+	if err = approvalTrail(dir, a, a.Status, username, ""); err != nil {
+		return *a, err
+	}
+	delete(p.pending, name)
+
+	return *a, nil
+}
+
+func approvalError(err error) error {
+	switch err {
+	case ErrApprovalNotFound:
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	case ErrApprovalPending, ErrApprovalExpired:
+		return fiber.NewError(http.StatusConflict, err.Error())
+	case ErrApprovalSameUser:
+		return fiber.NewError(http.StatusForbidden, err.Error())
+	default:
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func oVirtFailoverRequest(c *fiber.Ctx) error {
+	a, err := approvalsPending.Request(c.Params("name"), "failover", username(c))
+	if err != nil {
+		return approvalError(err)
+	}
+	return c.Status(http.StatusAccepted).JSON(a)
+}
+
+func oVirtFailoverApproval(c *fiber.Ctx) error {
+	if !Cfg.Approval {
+		return fiber.NewError(http.StatusNotFound, ErrApprovalNotSupported.Error())
+	}
+	a, err := approvalsPending.Get(c.Params("name"))
+	if err != nil {
+		return approvalError(err)
+	}
+	return c.Status(http.StatusOK).JSON(a)
+}
+
+func oVirtFailoverReject(c *fiber.Ctx) error {
+	if !Cfg.Approval {
+		return fiber.NewError(http.StatusNotFound, ErrApprovalNotSupported.Error())
+	}
+	a, err := approvalsPending.Resolve(c.Params("name"), c.Params("id"), username(c), false)
+	if err != nil {
+		return approvalError(err)
+	}
+	return c.Status(http.StatusOK).JSON(a)
+}
+
+func oVirtFailoverApprove(c *fiber.Ctx) (err error) {
+	if !Cfg.Approval {
+		return fiber.NewError(http.StatusNotFound, ErrApprovalNotSupported.Error())
+	}
+	var (
+		a      Approval
+		out    string
+		result ovirt.PlaybookResult
+	)
+	name := c.Params("name")
+	user := username(c)
+	settings, err := playbookSettings(c, "failover", name)
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+	if a, err = approvalsPending.Resolve(name, c.Params("id"), user, true); err != nil {
+		return approvalError(err)
+	}
+
+	dir := path.Join(Cfg.OVirtStoreDir, name)
+	_ = approvalTrail(dir, &a, ApprovalStarted, user, "")
+
+	ctx, completed := operationEvents(c, "failover", name)
+	ctx = ovirt.WithResult(ctx, &result)
+	ctx = ovirt.WithSettings(ctx, settings)
+	out, err = ovirt.FailoverContext(ctx, name, Cfg.OVirtStoreDir)
+	completed(&result, out, err)
+
+	if err == nil {
+		_ = approvalTrail(dir, &a, ApprovalSuccess, user, "")
+	} else {
+		_ = approvalTrail(dir, &a, ApprovalFailed, user, err.Error())
+	}
+	return operationResponse(c, &result, out, err)
+}
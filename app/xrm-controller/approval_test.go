@@ -0,0 +1,45 @@
+package xrmcontroller
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestExpireLostApprovals(t *testing.T) {
+	saved := Cfg
+	defer func() { Cfg = saved }()
+	Cfg.OVirtStoreDir = t.TempDir()
+	dir := path.Join(Cfg.OVirtStoreDir, "test")
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	trail := `{"time":"2023-06-01T10:00:00Z","id":"1","operation":"failover","status":"pending","username":"test1"}
+{"time":"2023-06-01T10:01:00Z","id":"1","operation":"failover","status":"rejected","username":"test2"}
+{"time":"2023-06-01T10:02:00Z","id":"2","operation":"failover","status":"pending","username":"test1"}
+{"time":"2023-06-01T10:0`
+	if err := os.WriteFile(path.Join(dir, approvalLogFile), []byte(trail), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := ExpireLostApprovals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].ID != "2" || expired[0].Name != "test" || expired[0].Status != ApprovalExpired {
+		t.Fatalf("ExpireLostApprovals() = %+v", expired)
+	}
+	b, err := os.ReadFile(path.Join(dir, approvalLogFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"id":"2","operation":"failover","status":"expired","username":"","message":"lost on controller restart"`) {
+		t.Errorf("approval trail = %q", string(b))
+	}
+
+	// already expired
+	if expired, err = ExpireLostApprovals(); err != nil || len(expired) != 0 {
+		t.Errorf("ExpireLostApprovals() = %+v, %v", expired, err)
+	}
+}
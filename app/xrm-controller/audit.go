@@ -0,0 +1,128 @@
+package xrmcontroller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xrm-tech/xrm-controller/pkg/audit"
+)
+
+var (
+	ErrAuditDisabled = errors.New("audit log is disabled")
+
+	auditQueryLimit = 1000
+)
+
+func auditStatus(code int) string {
+	switch {
+	case code == http.StatusAccepted:
+		return "pending"
+	case code < 300:
+		return "success"
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return "denied"
+	default:
+		return "failed"
+	}
+}
+
+// statusCode return response status code for handler result (before error handler call)
+func statusCode(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var e *fiber.Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// audited write audit record for operation (after operation completion)
+func audited(operation string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if Cfg.Audit == nil {
+			return c.Next()
+		}
+
+		start := time.Now()
+		err := c.Next()
+
+		code := statusCode(c, err)
+		var errMsg string
+		if err != nil {
+			// skip command output
+			errMsg, _, _ = strings.Cut(err.Error(), "\n")
+		}
+		clientIP, _ := c.Locals("client_ip").(string)
+
+		if auditErr := Cfg.Audit.Append(audit.Record{
+			Time:      start.UTC(),
+			Username:  username(c),
+			ClientIP:  clientIP,
+			Operation: operation,
+			Name:      c.Params("name"),
+			Status:    auditStatus(code),
+			Code:      code,
+			Error:     errMsg,
+			Duration:  time.Since(start).Seconds(),
+		}); auditErr != nil {
+			Cfg.Logger.Error().Str("logger", "audit").Str("operation", operation).Str("name", c.Params("name")).Err(auditErr).Msg("audit record write failed")
+		}
+
+		return err
+	}
+}
+
+func parseAuditFilter(c *fiber.Ctx) (filter audit.Filter, err error) {
+	if s := c.Query("from"); s != "" {
+		if filter.From, err = time.Parse(time.RFC3339, s); err != nil {
+			return filter, errors.New("from is invalid: " + err.Error())
+		}
+	}
+	if s := c.Query("until"); s != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, s); err != nil {
+			return filter, errors.New("until is invalid: " + err.Error())
+		}
+	}
+	filter.Username = c.Query("username")
+	filter.Name = c.Query("name")
+	filter.Operation = c.Query("operation")
+	filter.Limit = auditQueryLimit
+	if s := c.Query("limit"); s != "" {
+		if filter.Limit, err = strconv.Atoi(s); err != nil || filter.Limit <= 0 {
+			return filter, errors.New("limit is invalid")
+		}
+	}
+	return
+}
+
+func auditQuery(c *fiber.Ctx) error {
+	if Cfg.Audit == nil {
+		return fiber.NewError(http.StatusNotFound, ErrAuditDisabled.Error())
+	}
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+	records, err := Cfg.Audit.Query(filter)
+	if err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+	return c.Status(http.StatusOK).JSON(records)
+}
+
+func auditVerify(c *fiber.Ctx) error {
+	if Cfg.Audit == nil {
+		return fiber.NewError(http.StatusNotFound, ErrAuditDisabled.Error())
+	}
+	n, err := Cfg.Audit.Verify()
+	if err != nil {
+		return fiber.NewError(http.StatusConflict, err.Error())
+	}
+	return c.Status(http.StatusOK).SendString("verified " + strconv.FormatUint(n, 10) + " records")
+}
@@ -1,21 +1,62 @@
 package xrmcontroller
 
 import (
+	"net"
+	"time"
+
 	"github.com/goccy/go-json"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/basicauth"
 	"github.com/msaf1980/fiberlog"
 	"github.com/rs/zerolog"
+	"github.com/xrm-tech/xrm-controller/ovirt"
+	"github.com/xrm-tech/xrm-controller/pkg/audit"
+	"github.com/xrm-tech/xrm-controller/pkg/jobs"
+	"github.com/xrm-tech/xrm-controller/pkg/notify"
+	"github.com/xrm-tech/xrm-controller/pkg/secrets"
+	"github.com/xrm-tech/xrm-controller/pkg/webhook"
 )
 
 type Config struct {
 	StoreDir      string
 	OVirtStoreDir string
 	Listen        string
-	TLSCert       string
-	TLSKey        string
-	Users         map[string]string
-	Logger        zerolog.Logger
+	// max request body size (fiber default if 0)
+	BodyLimit int
+	TLSCert   string
+	TLSKey    string
+	// cert/key content (from env), has priority over files
+	TLSCertPEM     []byte
+	TLSKeyPEM      []byte
+	TLSKeyPassword string
+	TLSReload      time.Duration
+	// client certificates verification
+	TLSClientCA           string
+	TLSClientCertOptional bool
+	CertUsers             map[string]string // certificate subject -> username
+	Users                 map[string]string
+	Roles                 Roles
+	// address access lists for read-only and mutating routes
+	ReadACL        IPACL
+	WriteACL       IPACL
+	TrustedProxies []*net.IPNet
+	// failover require approval by another user
+	Approval        bool
+	ApprovalTimeout time.Duration
+	Logger          zerolog.Logger
+	// audit log, disabled if nil
+	Audit *audit.Log
+	// operations jobs history, disabled if nil
+	Jobs *jobs.Store
+	// secret references resolver and local secrets store (disabled if nil)
+	Secrets      secrets.Resolver
+	SecretsStore *secrets.Store
+	// operation lifecycle events webhooks, disabled if nil
+	Webhooks *webhook.Dispatcher
+	// operation lifecycle events notifiers (webhooks, mail)
+	Notifiers notify.Notifiers
+	// ansible-playbook settings (defaults, overrides and limits for per-request settings)
+	Playbook ovirt.PlaybookConfig
 }
 
 var (
@@ -26,6 +67,7 @@ func RouterInit() (app *fiber.App) {
 	app = fiber.New(fiber.Config{
 		JSONEncoder: json.Marshal,
 		JSONDecoder: Decode,
+		BodyLimit:   Cfg.BodyLimit,
 	})
 
 	app.Use(fiberlog.New(fiberlog.Config{
@@ -33,18 +75,63 @@ func RouterInit() (app *fiber.App) {
 		Next: func(ctx *fiber.Ctx) bool {
 			return false
 		},
-		LogUsername: "username",
-		Tags:        []string{"req_body", "storages"},
+		LogUsername:     "username",
+		LogForwardedFor: true,
+		Tags:            []string{"client_ip", "cert_subject", "req_body", "storages"},
 	}))
 
+	app.Use(httpMetrics)
+	app.Use(traced)
+
+	// probes (without access lists and auth)
+	app.Get("/healthz", healthz)
+	app.Get("/readyz", readyz)
+
+	// address access lists
+	app.Use(ipACL)
+
+	// reject new operations while shutting down
+	app.Use(trackOperations)
+
+	// client certificate auth
+	app.Use(certAuth)
+
 	// enable basic auth
-	app.Use(basicauth.New(basicauth.Config{Users: Cfg.Users}))
+	app.Use(basicauth.New(basicauth.Config{Users: Cfg.Users, Next: certAuthenticated}))
+
+	app.Get("/metrics", authorize(RoleViewer), metricsHandler)
+	app.Get("/status", authorize(RoleViewer), statusHandler)
+
+	// Audit
+	app.Get("/audit", authorize(RoleAdmin), auditQuery)
+	app.Get("/audit/verify", authorize(RoleAdmin), auditVerify)
+
+	// Jobs
+	app.Get("/jobs", authorize(RoleViewer), jobsQuery)
+	app.Get("/jobs/:id", authorize(RoleViewer), jobGet)
+	app.Post("/jobs/:id/cancel", audited("job_cancel"), jobCancel)
+
+	// Webhooks
+	app.Get("/webhooks/deliveries", authorize(RoleAdmin), webhookDeliveries)
+
+	// Secrets store
+	app.Get("/secrets", authorize(RoleAdmin), secretsList)
+	app.Post("/secrets/:secret", audited("secret_set"), authorize(RoleAdmin), secretSet)
+	app.Delete("/secrets/:secret", audited("secret_delete"), authorize(RoleAdmin), secretDelete)
 
 	// OVirt
-	app.Get("/ovirt/delete/:name", oVirtDelete)
-	app.Post("/ovirt/generate/:name", oVirtGenerate)
-	app.Get("/ovirt/failover/:name", oVirtFailover)
-	app.Get("/ovirt/failback/:name", oVirtFailback)
+	app.Get("/ovirt/delete/:name", audited("delete"), authorize(RoleAdmin), oVirtDelete)
+	app.Post("/ovirt/credentials", audited("credentials"), authorize(RoleAdmin), oVirtEngineCredentials)
+	app.Post("/ovirt/credentials/:name", audited("credentials"), authorize(RoleAdmin), oVirtCredentials)
+	app.Post("/ovirt/generate/:name", audited("generate"), authorize(RoleAdmin), oVirtGenerate)
+	app.Get("/ovirt/failover/:name", audited("failover"), authorize(RoleOperator), oVirtFailover)
+	app.Get("/ovirt/failover/:name/approval", authorize(RoleViewer), oVirtFailoverApproval)
+	app.Get("/ovirt/failover/:name/approve/:id", audited("failover_approve"), authorize(RoleOperator), oVirtFailoverApprove)
+	app.Get("/ovirt/failover/:name/reject/:id", audited("failover_reject"), authorize(RoleOperator), oVirtFailoverReject)
+	app.Get("/ovirt/failback/:name", audited("failback"), authorize(RoleOperator), oVirtFailback)
+	app.Get("/ovirt/cleanup/:name", audited("cleanup"), authorize(RoleOperator), oVirtCleanup)
+	app.Get("/ovirt/logs/:name", authorize(RoleViewer), oVirtLogs)
+	app.Get("/ovirt/:operation/:name/result", authorize(RoleViewer), oVirtResult)
 
 	return
 }
@@ -0,0 +1,81 @@
+package xrmcontroller
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xrm-tech/xrm-controller/ovirt"
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+type CheckStatus string
+
+const (
+	CheckOK     CheckStatus = "ok"
+	CheckFailed CheckStatus = "failed"
+)
+
+// Check is a readiness check result
+type Check struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// Readiness is a readiness checks results, status is failed if any check failed.
+// Probe is not authenticated, so only recovery counters are returned (details are returned by /status)
+type Readiness struct {
+	Status CheckStatus `json:"status"`
+	Checks []Check     `json:"checks"`
+	// Interrupted is a jobs count, interrupted by controller restart
+	Interrupted int `json:"interrupted,omitempty"`
+	// StaleLocks is a removed stale config locks count
+	StaleLocks int `json:"stale_locks,omitempty"`
+	// Orphans is a running playbook processes count, survived controller restart
+	Orphans int `json:"orphans,omitempty"`
+}
+
+func (r *Readiness) check(name string, err error) {
+	c := Check{Name: name, Status: CheckOK}
+	if err != nil {
+		c.Status = CheckFailed
+		c.Error = err.Error()
+		r.Status = CheckFailed
+	}
+	r.Checks = append(r.Checks, c)
+}
+
+func readiness() Readiness {
+	r := Readiness{Status: CheckOK, Checks: make([]Check, 0, 5)}
+
+	r.check("store_dir", utils.DirWritable(Cfg.StoreDir))
+	r.check("ovirt_store_dir", utils.DirWritable(Cfg.OVirtStoreDir))
+	r.check("ovirt_template", ovirt.CheckTemplate(Cfg.OVirtStoreDir))
+	r.check("ansible", ovirt.CheckAnsible())
+	r.check("ovirt_collection", ovirt.CheckCollection())
+	if Draining() {
+		r.check("shutdown", ErrShuttingDown)
+	}
+
+	if recovery != nil {
+		r.Interrupted = len(recovery.Interrupted)
+		r.StaleLocks = len(recovery.StaleLocks)
+	}
+	r.Orphans = len(ovirt.Orphans())
+
+	return r
+}
+
+// healthz is a liveness probe (controller is running)
+func healthz(c *fiber.Ctx) error {
+	return c.Status(http.StatusOK).JSON(fiber.Map{"status": CheckOK})
+}
+
+// readyz is a readiness probe (controller can run operations)
+func readyz(c *fiber.Ctx) error {
+	r := readiness()
+	if r.Status == CheckOK {
+		return c.Status(http.StatusOK).JSON(r)
+	}
+	return c.Status(http.StatusServiceUnavailable).JSON(r)
+}
@@ -0,0 +1,217 @@
+package xrmcontroller
+
+import (
+	"errors"
+	"net/http"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xrm-tech/xrm-controller/ovirt"
+	"github.com/xrm-tech/xrm-controller/pkg/jobs"
+)
+
+var (
+	ErrJobsDisabled = errors.New("jobs history is disabled")
+	ErrJobNotQueued = errors.New("job is not queued")
+
+	jobsQueryLimit = 100
+)
+
+// jobLog return playbook log file (relative to config dir), relative to store dir (if possible)
+func jobLog(name, file string) string {
+	logFile := path.Join(Cfg.OVirtStoreDir, name, file)
+	if Cfg.StoreDir != "" {
+		if rel, err := filepath.Rel(Cfg.StoreDir, logFile); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return logFile
+}
+
+func putJob(job *jobs.Job) {
+	if err := Cfg.Jobs.Put(*job); err != nil {
+		Cfg.Logger.Error().Str("logger", "jobs").Str("id", job.ID).Str("operation", job.Operation).Str("name", job.Name).Err(err).Msg("job write failed")
+	}
+}
+
+// jobQueued record queued job
+func jobQueued(id, operation, name, username string) *jobs.Job {
+	now := time.Now().UTC()
+	job := &jobs.Job{
+		ID:        id,
+		Name:      name,
+		Operation: operation,
+		Username:  username,
+		Queued:    &now,
+		Start:     now,
+		Status:    jobs.StatusQueued,
+		ExitCode:  -1,
+	}
+	putJob(job)
+	return job
+}
+
+// jobStarted record started job (job is nil, if job was not queued), return nil if jobs history is disabled
+func jobStarted(job *jobs.Job, operation, name, username string, start time.Time) *jobs.Job {
+	if Cfg.Jobs == nil {
+		return nil
+	}
+	if job == nil {
+		job = &jobs.Job{ID: jobs.NewID(), Name: name, Operation: operation, Username: username, ExitCode: -1}
+	}
+	job.Start = start.UTC()
+	job.Status = jobs.StatusRunning
+	job.Log = jobLog(name, operation+".log")
+	putJob(job)
+	return job
+}
+
+// jobCompleted record job completion with structured playbook result
+func jobCompleted(job *jobs.Job, result *ovirt.PlaybookResult, err error) {
+	if job == nil {
+		return
+	}
+	end := time.Now().UTC()
+	job.End = &end
+	if err == nil {
+		job.Status = jobs.StatusSuccess
+		job.ExitCode = 0
+	} else if job.Status == jobs.StatusQueued {
+		// canceled or failed in queue
+		job.Status = jobs.StatusCanceled
+		if err != ovirt.ErrQueueCanceled {
+			job.Error = err.Error()
+		}
+	} else {
+		job.Status = jobs.StatusFailed
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			job.ExitCode = exitErr.ExitCode()
+		}
+		// skip command output
+		job.Error, _, _ = strings.Cut(err.Error(), "\n")
+	}
+	if result != nil && result.Result != "" {
+		if b, err := json.Marshal(result); err == nil {
+			job.Result = b
+		}
+		// current log is moved to logs history on next run
+		if result.Log != "" {
+			job.Log = jobLog(job.Name, result.Log)
+		}
+	}
+	putJob(job)
+}
+
+// JobsPage is a jobs query response
+type JobsPage struct {
+	// Total is a matched jobs count
+	Total int        `json:"total"`
+	Jobs  []jobs.Job `json:"jobs"`
+}
+
+func parseJobsFilter(c *fiber.Ctx) (filter jobs.Filter, err error) {
+	if s := c.Query("from"); s != "" {
+		if filter.From, err = time.Parse(time.RFC3339, s); err != nil {
+			return filter, errors.New("from is invalid: " + err.Error())
+		}
+	}
+	if s := c.Query("until"); s != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, s); err != nil {
+			return filter, errors.New("until is invalid: " + err.Error())
+		}
+	}
+	filter.Username = c.Query("username")
+	filter.Name = c.Query("name")
+	filter.Operation = c.Query("operation")
+	filter.Status = jobs.Status(c.Query("status"))
+	if s := c.Query("offset"); s != "" {
+		if filter.Offset, err = strconv.Atoi(s); err != nil || filter.Offset < 0 {
+			return filter, errors.New("offset is invalid")
+		}
+	}
+	filter.Limit = jobsQueryLimit
+	if s := c.Query("limit"); s != "" {
+		if filter.Limit, err = strconv.Atoi(s); err != nil || filter.Limit <= 0 {
+			return filter, errors.New("limit is invalid")
+		}
+	}
+	return
+}
+
+func jobsQuery(c *fiber.Ctx) error {
+	if Cfg.Jobs == nil {
+		return fiber.NewError(http.StatusNotFound, ErrJobsDisabled.Error())
+	}
+	filter, err := parseJobsFilter(c)
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+	var page JobsPage
+	page.Jobs, page.Total = Cfg.Jobs.Query(filter)
+	setQueuePositions(page.Jobs)
+	return c.Status(http.StatusOK).JSON(page)
+}
+
+// setQueuePositions set positions in operations queue for queued jobs
+func setQueuePositions(jobsList []jobs.Job) {
+	var positions map[string]int
+	for i := range jobsList {
+		if jobsList[i].Status != jobs.StatusQueued {
+			continue
+		}
+		if positions == nil {
+			queue := ovirt.Queue()
+			positions = make(map[string]int, len(queue))
+			for _, q := range queue {
+				positions[q.ID] = q.Position
+			}
+		}
+		jobsList[i].QueuePosition = positions[jobsList[i].ID]
+	}
+}
+
+func jobGet(c *fiber.Ctx) error {
+	if Cfg.Jobs == nil {
+		return fiber.NewError(http.StatusNotFound, ErrJobsDisabled.Error())
+	}
+	job, err := Cfg.Jobs.Get(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	}
+	jobsList := []jobs.Job{job}
+	setQueuePositions(jobsList)
+	return c.Status(http.StatusOK).JSON(jobsList[0])
+}
+
+// operationRole return role, required for operation run
+func operationRole(operation string) Role {
+	if operation == "generate" {
+		return RoleAdmin
+	}
+	return RoleOperator
+}
+
+// jobCancel cancel queued job (role for job operation on config is required)
+func jobCancel(c *fiber.Ctx) error {
+	if Cfg.Jobs == nil {
+		return fiber.NewError(http.StatusNotFound, ErrJobsDisabled.Error())
+	}
+	job, err := Cfg.Jobs.Get(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	}
+	if Cfg.Roles.Role(username(c), job.Name) < operationRole(job.Operation) {
+		return fiber.NewError(http.StatusForbidden, ErrForbidden.Error())
+	}
+	if job.Status != jobs.StatusQueued || !ovirt.CancelQueued(job.ID) {
+		return fiber.NewError(http.StatusConflict, ErrJobNotQueued.Error())
+	}
+	return c.Status(http.StatusOK).SendString("canceled")
+}
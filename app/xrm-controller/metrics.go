@@ -0,0 +1,35 @@
+package xrmcontroller
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/common/expfmt"
+	"github.com/xrm-tech/xrm-controller/pkg/metrics"
+)
+
+// httpMetrics record request latency by route pattern (not path, for limit labels cardinality)
+func httpMetrics(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+	// method is copied, fiber strings are reused after request
+	metrics.ObserveHTTP(strings.Clone(c.Method()), c.Route().Path, statusCode(c, err), start)
+	return err
+}
+
+func metricsHandler(c *fiber.Ctx) error {
+	mfs, err := metrics.Registry.Gather()
+	if err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+	c.Set(fiber.HeaderContentType, string(expfmt.FmtText))
+	enc := expfmt.NewEncoder(c.Response().BodyWriter(), expfmt.FmtText)
+	for _, mf := range mfs {
+		if err = enc.Encode(mf); err != nil {
+			return fiber.NewError(http.StatusInternalServerError, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package xrmcontroller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xrm-tech/xrm-controller/ovirt"
+	"github.com/xrm-tech/xrm-controller/pkg/jobs"
+	"github.com/xrm-tech/xrm-controller/pkg/notify"
+)
+
+// logExcerptLines is a playbook output lines, included in completed event
+var logExcerptLines = 20
+
+// operationEvents return operation context (started event is sent and job is recorded when operation is really started) and completion callback
+func operationEvents(c *fiber.Ctx, operation, name string) (context.Context, func(result *ovirt.PlaybookResult, out string, err error)) {
+	if len(Cfg.Notifiers) == 0 && Cfg.Jobs == nil {
+		return c.UserContext(), func(*ovirt.PlaybookResult, string, error) {}
+	}
+
+	// events are sent asynchronously, but fiber strings are reused
+	name = strings.Clone(name)
+	user := strings.Clone(username(c))
+
+	var (
+		start time.Time
+		job   *jobs.Job
+	)
+	ctx := c.UserContext()
+	if Cfg.Jobs != nil {
+		// queued operation can be canceled with job id
+		id := jobs.NewID()
+		ctx = ovirt.WithQueued(ctx, id, func() {
+			job = jobQueued(id, operation, name, user)
+		})
+	}
+	ctx = ovirt.WithStarted(ctx, func() {
+		start = time.Now()
+		job = jobStarted(job, operation, name, user, start)
+		if len(Cfg.Notifiers) > 0 {
+			Cfg.Notifiers.Notify(notify.Started(operation, name, user))
+		}
+	})
+	if Cfg.Jobs != nil {
+		// playbook process is checked on startup, if job was interrupted by restart
+		ctx = ovirt.WithProcessStarted(ctx, func(pid int) {
+			if job != nil {
+				job.PID = pid
+				putJob(job)
+			}
+		})
+	}
+
+	return ctx, func(result *ovirt.PlaybookResult, out string, err error) {
+		if start.IsZero() {
+			// queued operation was canceled or failed before start
+			jobCompleted(job, nil, err)
+			return
+		}
+		jobCompleted(job, result, err)
+		if len(Cfg.Notifiers) > 0 {
+			e := notify.Completed(operation, name, user, start, storagesRemap(operation, name, out), err)
+			e.Log = notify.Excerpt(out, logExcerptLines)
+			Cfg.Notifiers.Notify(e)
+		}
+	}
+}
+
+// storagesRemap return storages remap summary for event: generate output messages or remap, stored in config (for failover/failback)
+func storagesRemap(operation, name, out string) []string {
+	switch operation {
+	case "failover", "failback":
+		remap, err := ovirt.StorageRemap(name, Cfg.OVirtStoreDir, operation == "failback")
+		if err != nil {
+			Cfg.Logger.Error().Str("logger", "notify").Str("operation", operation).Str("name", name).Err(err).Msg("storages remap read failed")
+		}
+		return remap
+	default:
+		return ovirt.Warnings(out)
+	}
+}
@@ -2,6 +2,9 @@ package xrmcontroller
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog"
@@ -21,6 +24,7 @@ func oVirtGenerate(c *fiber.Ctx) (err error) {
 		sitesConfig ovirt.GenerateVars
 		storages    string
 		out         string
+		result      ovirt.PlaybookResult
 	)
 	if err = c.BodyParser(&sitesConfig); err != nil {
 		c.Context().SetUserValue("req_body", utils.UnsafeString(bodyPasswordCleanup(c.Request().Body())))
@@ -31,6 +35,11 @@ func oVirtGenerate(c *fiber.Ctx) (err error) {
 		c.Context().SetUserValue("req_body", utils.UnsafeString(bodyPasswordCleanup(c.Request().Body())))
 		return fiber.NewError(http.StatusBadRequest, err.Error())
 	}
+
+	if err := sitesConfig.ResolveSecrets(Cfg.Secrets); err != nil {
+		c.Context().SetUserValue("req_body", utils.UnsafeString(bodyPasswordCleanup(c.Request().Body())))
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
 	name := c.Params("name")
 
 	ovirt.StripStorageDomains(sitesConfig.StorageDomains)
@@ -39,44 +48,250 @@ func oVirtGenerate(c *fiber.Ctx) (err error) {
 		c.Context().SetUserValue("req_body", utils.UnsafeString(bodyPasswordCleanup(c.Request().Body())))
 	}
 
-	storages, out, err = sitesConfig.Generate(name, Cfg.OVirtStoreDir)
+	settings, err := playbookSettings(c, "generate", name)
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	ctx, completed := operationEvents(c, "generate", name)
+	ctx = ovirt.WithSettings(ctx, settings)
+	ctx = ovirt.WithResult(ctx, &result)
+	storages, out, err = sitesConfig.GenerateContext(ctx, name, Cfg.OVirtStoreDir)
+	result.Warnings = ovirt.Warnings(out)
+	completed(&result, out, err)
 
 	if Cfg.Logger.GetLevel() == zerolog.DebugLevel || Cfg.Logger.GetLevel() == zerolog.TraceLevel {
 		c.Context().SetUserValue("storages", storages)
 	}
 
-	if err == nil {
-		return c.Status(http.StatusOK).SendString(out)
-	} else {
-		return fiber.NewError(http.StatusInternalServerError, err.Error()+"\n"+out)
-	}
+	return operationResponse(c, &result, out, err)
 }
 
 func oVirtFailover(c *fiber.Ctx) (err error) {
+	if Cfg.Approval {
+		return oVirtFailoverRequest(c)
+	}
+
 	var (
-		out string
+		out    string
+		result ovirt.PlaybookResult
 	)
 	name := c.Params("name")
 
 	// TODO (SECURITY): cleanup token from out
-	if out, err = ovirt.Failover(name, Cfg.OVirtStoreDir); err == nil {
-		// TODO: debug loglevel ??
-		return c.Status(http.StatusOK).SendString(out)
-	} else {
-		return fiber.NewError(http.StatusInternalServerError, err.Error()+"\n"+out)
+	settings, err := playbookSettings(c, "failover", name)
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
 	}
+
+	ctx, completed := operationEvents(c, "failover", name)
+	ctx = ovirt.WithSettings(ctx, settings)
+	ctx = ovirt.WithResult(ctx, &result)
+	out, err = ovirt.FailoverContext(ctx, name, Cfg.OVirtStoreDir)
+	completed(&result, out, err)
+
+	return operationResponse(c, &result, out, err)
 }
 
 func oVirtFailback(c *fiber.Ctx) (err error) {
 	var (
-		out string
+		out    string
+		result ovirt.PlaybookResult
 	)
 	name := c.Params("name")
 
-	if out, err = ovirt.Failback(name, Cfg.OVirtStoreDir); err == nil {
-		// TODO: debug loglevel ??
+	settings, err := playbookSettings(c, "failback", name)
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	ctx, completed := operationEvents(c, "failback", name)
+	ctx = ovirt.WithSettings(ctx, settings)
+	ctx = ovirt.WithResult(ctx, &result)
+	out, err = ovirt.FailbackContext(ctx, name, Cfg.OVirtStoreDir)
+	completed(&result, out, err)
+
+	return operationResponse(c, &result, out, err)
+}
+
+func oVirtCleanup(c *fiber.Ctx) (err error) {
+	var (
+		out    string
+		result ovirt.PlaybookResult
+	)
+	name := c.Params("name")
+
+	settings, err := playbookSettings(c, "cleanup", name)
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	ctx, completed := operationEvents(c, "cleanup", name)
+	ctx = ovirt.WithSettings(ctx, settings)
+	ctx = ovirt.WithResult(ctx, &result)
+	out, err = ovirt.CleanupContext(ctx, name, Cfg.OVirtStoreDir)
+	completed(&result, out, err)
+
+	return operationResponse(c, &result, out, err)
+}
+
+func oVirtCredentials(c *fiber.Ctx) (err error) {
+	var credentials ovirt.CredentialsVars
+	if err = c.BodyParser(&credentials); err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+	if err = credentials.Validate(); err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+	if err = credentials.ResolveSecrets(Cfg.Secrets); err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = credentials.UpdateCredentials(c.Params("name"), Cfg.OVirtStoreDir); err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+	return c.Status(http.StatusOK).SendString("success")
+}
+
+func oVirtEngineCredentials(c *fiber.Ctx) (err error) {
+	var credentials ovirt.EngineCredentialsVars
+	if err = c.BodyParser(&credentials); err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+	if err = credentials.Validate(); err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+	if err = credentials.ResolveSecrets(Cfg.Secrets); err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	updated, err := credentials.UpdateCredentials(Cfg.OVirtStoreDir)
+	if err != nil {
+		if err == ovirt.ErrEngineNotFound {
+			return fiber.NewError(http.StatusNotFound, err.Error())
+		}
+		var buf strings.Builder
+		buf.WriteString(err.Error())
+		if len(updated) > 0 {
+			buf.WriteString("\nupdated: ")
+			buf.WriteString(strings.Join(updated, ", "))
+		}
+		return fiber.NewError(http.StatusInternalServerError, buf.String())
+	}
+	return c.Status(http.StatusOK).SendString("updated: " + strings.Join(updated, ", "))
+}
+
+// operationResponse return playbook output or structured playbook result (if requested with Accept: application/json)
+func operationResponse(c *fiber.Ctx, result *ovirt.PlaybookResult, out string, err error) error {
+	if result.Operation != "" && c.Accepts(fiber.MIMETextPlain, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusInternalServerError
+			// operation can be failed after playbook
+			result.Result = "failed"
+			result.Error = err.Error()
+		}
+		return c.Status(status).JSON(result)
+	}
+	if err == nil {
 		return c.Status(http.StatusOK).SendString(out)
 	} else {
 		return fiber.NewError(http.StatusInternalServerError, err.Error()+"\n"+out)
 	}
 }
+
+// oVirtResult return last structured playbook result for operation
+func oVirtResult(c *fiber.Ctx) error {
+	result, err := ovirt.ReadResult(c.Params("name"), Cfg.OVirtStoreDir, c.Params("operation"))
+	if err != nil {
+		switch err {
+		case ovirt.ErrNameInvalid, ovirt.ErrOperationInvalid:
+			return fiber.NewError(http.StatusBadRequest, err.Error())
+		case ovirt.ErrResultNotFound:
+			return fiber.NewError(http.StatusNotFound, err.Error())
+		default:
+			return fiber.NewError(http.StatusInternalServerError, err.Error())
+		}
+	}
+	return c.Status(http.StatusOK).JSON(result)
+}
+
+// playbookSettings return playbook settings for operation on config, can be overridden by request query parameters
+// (verbosity, timeout, forks, extra_var=key=value, env=KEY=value) within limits
+func playbookSettings(c *fiber.Ctx, operation, name string) (ovirt.PlaybookSettings, error) {
+	var (
+		request ovirt.PlaybookSettings
+		set     bool
+		errs    ovirt.Errors
+	)
+	args := c.Context().QueryArgs()
+	if v := args.Peek("verbosity"); len(v) > 0 {
+		set = true
+		if n, err := strconv.Atoi(string(v)); err == nil {
+			request.Verbosity = &n
+		} else {
+			errs = append(errs, ovirt.ErrVerbosityInvalid.Error())
+		}
+	}
+	if v := args.Peek("timeout"); len(v) > 0 {
+		set = true
+		if d, err := time.ParseDuration(string(v)); err == nil && d > 0 {
+			request.Timeout = ovirt.Duration(d)
+		} else {
+			errs = append(errs, ovirt.ErrTimeoutInvalid.Error())
+		}
+	}
+	if v := args.Peek("forks"); len(v) > 0 {
+		set = true
+		if n, err := strconv.Atoi(string(v)); err == nil && n > 0 {
+			request.Forks = n
+		} else {
+			errs = append(errs, ovirt.ErrForksInvalid.Error())
+		}
+	}
+	for _, v := range args.PeekMulti("extra_var") {
+		set = true
+		if k, val, ok := strings.Cut(string(v), "="); ok {
+			if request.ExtraVars == nil {
+				request.ExtraVars = make(map[string]string)
+			}
+			request.ExtraVars[k] = val
+		} else {
+			errs = append(errs, "extra_var is invalid: must be key=value")
+		}
+	}
+	for _, v := range args.PeekMulti("env") {
+		set = true
+		if k, val, ok := strings.Cut(string(v), "="); ok {
+			if request.Env == nil {
+				request.Env = make(map[string]string)
+			}
+			request.Env[k] = val
+		} else {
+			errs = append(errs, "env is invalid: must be KEY=value")
+		}
+	}
+	if len(errs) > 0 {
+		return ovirt.PlaybookSettings{}, errs
+	}
+	if !set {
+		return Cfg.Playbook.Settings(operation, name, nil)
+	}
+	return Cfg.Playbook.Settings(operation, name, &request)
+}
+
+// oVirtLogs return playbook run logs index for config (operation parameter for filter by operation)
+func oVirtLogs(c *fiber.Ctx) error {
+	logs, err := ovirt.Logs(c.Params("name"), Cfg.OVirtStoreDir, c.Query("operation"))
+	if err != nil {
+		switch err {
+		case ovirt.ErrNameInvalid, ovirt.ErrOperationInvalid:
+			return fiber.NewError(http.StatusBadRequest, err.Error())
+		case ovirt.ErrDirNotExist:
+			return fiber.NewError(http.StatusNotFound, err.Error())
+		default:
+			return fiber.NewError(http.StatusInternalServerError, err.Error())
+		}
+	}
+	return c.Status(http.StatusOK).JSON(logs)
+}
@@ -0,0 +1,123 @@
+package xrmcontroller
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	ErrRoleInvalid     = errors.New("role is invalid")
+	ErrRoleRuleInvalid = errors.New("role rule is invalid (username:role[:pattern])")
+	ErrForbidden       = errors.New("permission denied")
+)
+
+// Role is a user access level, each role include permissions of lower roles
+type Role int8
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleOperator
+	RoleAdmin
+)
+
+var roleStrings = []string{"none", "viewer", "operator", "admin"}
+
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleStrings) {
+		return "unknown"
+	}
+	return roleStrings[r]
+}
+
+func ParseRole(s string) (Role, error) {
+	for i, name := range roleStrings {
+		if i > 0 && s == name {
+			return Role(i), nil
+		}
+	}
+	return RoleNone, ErrRoleInvalid
+}
+
+// RoleRule grant role for configs, matched by pattern (path.Match syntax, empty for any config)
+type RoleRule struct {
+	Role    Role
+	Pattern string
+}
+
+func (r RoleRule) Match(name string) bool {
+	if r.Pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(r.Pattern, name)
+	return ok
+}
+
+// Roles is a user role rules
+type Roles map[string][]RoleRule
+
+// ParseRoles parse role rules (username:role[:pattern],...)
+func ParseRoles(rules []string) (Roles, error) {
+	roles := make(Roles)
+	for _, rule := range rules {
+		if rule == "" {
+			// skip empty
+			continue
+		}
+		username, s, ok := strings.Cut(rule, ":")
+		if !ok || username == "" {
+			return nil, ErrRoleRuleInvalid
+		}
+		roleName, pattern, _ := strings.Cut(s, ":")
+		role, err := ParseRole(roleName)
+		if err != nil {
+			return nil, errors.New(err.Error() + ": " + rule)
+		}
+		if _, err = path.Match(pattern, ""); err != nil {
+			return nil, errors.New(err.Error() + ": " + rule)
+		}
+		roles[username] = append(roles[username], RoleRule{Role: role, Pattern: pattern})
+	}
+	return roles, nil
+}
+
+// Role return the highest user role, matched for config name (empty name match only global rules)
+func (roles Roles) Role(username, name string) (role Role) {
+	if len(roles) == 0 {
+		// RBAC not configured, all users has full access
+		return RoleAdmin
+	}
+	for _, rule := range roles[username] {
+		if rule.Role > role {
+			if name == "" {
+				if rule.Pattern == "" {
+					role = rule.Role
+				}
+			} else if rule.Match(name) {
+				role = rule.Role
+			}
+		}
+	}
+	return
+}
+
+func username(c *fiber.Ctx) string {
+	if username, ok := c.Locals("username").(string); ok {
+		return username
+	}
+	return ""
+}
+
+// authorize check user role for route (and config name, if route has it)
+func authorize(role Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if Cfg.Roles.Role(username(c), c.Params("name")) < role {
+			return fiber.NewError(http.StatusForbidden, ErrForbidden.Error())
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,53 @@
+package xrmcontroller
+
+import (
+	"testing"
+)
+
+func TestRoles_Role(t *testing.T) {
+	roles, err := ParseRoles([]string{
+		"admin:admin",
+		"oper:viewer", "oper:operator:prod-*",
+		"test:admin:test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		username string
+		name     string
+		want     Role
+	}{
+		{username: "admin", name: "", want: RoleAdmin},
+		{username: "admin", name: "prod-1", want: RoleAdmin},
+		{username: "oper", name: "", want: RoleViewer},
+		{username: "oper", name: "prod-1", want: RoleOperator},
+		{username: "oper", name: "test", want: RoleViewer},
+		{username: "test", name: "", want: RoleNone},
+		{username: "test", name: "test", want: RoleAdmin},
+		{username: "test", name: "test2", want: RoleNone},
+		{username: "unknown", name: "test", want: RoleNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username+":"+tt.name, func(t *testing.T) {
+			if got := roles.Role(tt.username, tt.name); got != tt.want {
+				t.Errorf("Roles.Role() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// RBAC not configured
+	if got := Roles(nil).Role("unknown", "test"); got != RoleAdmin {
+		t.Errorf("Roles.Role() = %v, want %v", got, RoleAdmin)
+	}
+}
+
+func TestParseRoles_Invalid(t *testing.T) {
+	for _, rule := range []string{"admin", ":admin", "admin:root", "admin:admin:["} {
+		t.Run(rule, func(t *testing.T) {
+			if _, err := ParseRoles([]string{rule}); err == nil {
+				t.Errorf("ParseRoles(%q) must fail", rule)
+			}
+		})
+	}
+}
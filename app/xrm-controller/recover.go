@@ -0,0 +1,78 @@
+package xrmcontroller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xrm-tech/xrm-controller/ovirt"
+	"github.com/xrm-tech/xrm-controller/pkg/jobs"
+)
+
+// Recovery is a startup reconciliation result
+type Recovery struct {
+	Time time.Time `json:"time"`
+	// Interrupted is a jobs, interrupted by controller restart
+	Interrupted []jobs.Job `json:"interrupted,omitempty"`
+	// StaleLocks is a configs with removed stale locks
+	StaleLocks []string `json:"stale_locks,omitempty"`
+}
+
+// recovery is a last startup reconciliation result (set before server start)
+var recovery *Recovery
+
+// Recover reconcile operations, interrupted by controller restart (must be called before server start):
+// running and queued jobs are marked as interrupted, survived playbook processes keep config locked until exit,
+// stale config locks are removed
+func Recover() (*Recovery, error) {
+	r := &Recovery{Time: time.Now().UTC()}
+	recovery = r
+
+	if Cfg.Jobs != nil {
+		running, _ := Cfg.Jobs.Query(jobs.Filter{Status: jobs.StatusRunning})
+		queued, _ := Cfg.Jobs.Query(jobs.Filter{Status: jobs.StatusQueued})
+		running = append(running, queued...)
+		for i := range running {
+			job := &running[i]
+			job.Status = jobs.StatusInterrupted
+			job.Error = "interrupted by controller restart"
+			alive, err := ovirt.AdoptOrphan(job.Name, Cfg.OVirtStoreDir, job.Operation, job.PID)
+			if err != nil {
+				job.Error += ", playbook process check failed: " + err.Error()
+			} else if alive {
+				job.Error += ", playbook process " + strconv.Itoa(job.PID) + " is still running"
+			}
+			if err = Cfg.Jobs.Put(*job); err != nil {
+				return r, err
+			}
+			r.Interrupted = append(r.Interrupted, *job)
+		}
+	}
+
+	var err error
+	r.StaleLocks, err = ovirt.CleanStaleLocks(Cfg.OVirtStoreDir)
+
+	return r, err
+}
+
+// Status is a controller recovery status
+type Status struct {
+	// Recovery is a startup reconciliation result (if any operation was interrupted or stale lock was removed)
+	Recovery *Recovery `json:"recovery,omitempty"`
+	// Orphans is a running playbook processes, survived controller restart (configs are locked until exit)
+	Orphans []ovirt.Orphan `json:"orphans,omitempty"`
+}
+
+func status() Status {
+	var s Status
+	if recovery != nil && (len(recovery.Interrupted) > 0 || len(recovery.StaleLocks) > 0) {
+		s.Recovery = recovery
+	}
+	s.Orphans = ovirt.Orphans()
+	return s
+}
+
+func statusHandler(c *fiber.Ctx) error {
+	return c.Status(http.StatusOK).JSON(status())
+}
@@ -0,0 +1,78 @@
+package xrmcontroller
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xrm-tech/xrm-controller/pkg/jobs"
+)
+
+func TestRecover(t *testing.T) {
+	storeDir := t.TempDir()
+	saved := Cfg
+	defer func() { Cfg = saved }()
+	Cfg.StoreDir = storeDir
+	Cfg.OVirtStoreDir = path.Join(storeDir, "ovirt")
+	if err := os.MkdirAll(path.Join(Cfg.OVirtStoreDir, "test"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(Cfg.OVirtStoreDir, "test.lock"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	if Cfg.Jobs, err = jobs.Open(path.Join(storeDir, "jobs.jsonl"), jobs.Retention{}); err != nil {
+		t.Fatal(err)
+	}
+	defer Cfg.Jobs.Close()
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(time.Minute)
+	for _, j := range []jobs.Job{
+		{ID: "1", Name: "test", Operation: "generate", Start: start, End: &end, Status: jobs.StatusSuccess},
+		// process is not exist
+		{ID: "2", Name: "test", Operation: "failover", Start: start.Add(time.Hour), Status: jobs.StatusRunning, PID: -1, ExitCode: -1},
+	} {
+		if err = Cfg.Jobs.Put(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Interrupted) != 1 || r.Interrupted[0].ID != "2" || r.Interrupted[0].Status != jobs.StatusInterrupted ||
+		strings.Contains(r.Interrupted[0].Error, "still running") {
+		t.Errorf("Recover().Interrupted = %+v", r.Interrupted)
+	}
+	if !reflect.DeepEqual(r.StaleLocks, []string{"test"}) {
+		t.Errorf("Recover().StaleLocks = %v", r.StaleLocks)
+	}
+	if job, err := Cfg.Jobs.Get("2"); err != nil || job.Status != jobs.StatusInterrupted {
+		t.Errorf("interrupted job = %+v, %v", job, err)
+	}
+	if job, err := Cfg.Jobs.Get("1"); err != nil || job.Status != jobs.StatusSuccess {
+		t.Errorf("completed job = %+v, %v", job, err)
+	}
+	if s := status(); s.Recovery != r || len(s.Orphans) != 0 {
+		t.Errorf("status() = %+v", s)
+	}
+	if ready := readiness(); ready.Interrupted != 1 || ready.StaleLocks != 1 || ready.Orphans != 0 {
+		t.Errorf("readiness() = %+v", ready)
+	}
+
+	// nothing to recover on next start
+	if r, err = Recover(); err != nil || len(r.Interrupted) != 0 || len(r.StaleLocks) != 0 {
+		t.Errorf("Recover() = %+v, %v", r, err)
+	}
+	if s := status(); s.Recovery != nil {
+		t.Errorf("status().Recovery = %+v", s.Recovery)
+	}
+	if ready := readiness(); ready.Interrupted != 0 || ready.StaleLocks != 0 {
+		t.Errorf("readiness() = %+v", ready)
+	}
+}
@@ -0,0 +1,61 @@
+package xrmcontroller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xrm-tech/xrm-controller/pkg/secrets"
+)
+
+var (
+	ErrSecretsStoreDisabled = errors.New("secrets store is disabled")
+	ErrSecretEmpty          = errors.New("secret is empty")
+)
+
+func secretsError(err error) error {
+	if errors.Is(err, secrets.ErrNameInvalid) {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, secrets.ErrNotFound) {
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	}
+	return fiber.NewError(http.StatusInternalServerError, err.Error())
+}
+
+func secretsList(c *fiber.Ctx) error {
+	if Cfg.SecretsStore == nil {
+		return fiber.NewError(http.StatusNotFound, ErrSecretsStoreDisabled.Error())
+	}
+	names, err := Cfg.SecretsStore.List()
+	if err != nil {
+		return secretsError(err)
+	}
+	return c.Status(http.StatusOK).JSON(names)
+}
+
+// secretSet store secret, value is passed as request body
+func secretSet(c *fiber.Ctx) error {
+	if Cfg.SecretsStore == nil {
+		return fiber.NewError(http.StatusNotFound, ErrSecretsStoreDisabled.Error())
+	}
+	value := strings.TrimRight(string(c.Body()), "\r\n")
+	if value == "" {
+		return fiber.NewError(http.StatusBadRequest, ErrSecretEmpty.Error())
+	}
+	if err := Cfg.SecretsStore.Set(c.Params("secret"), value); err != nil {
+		return secretsError(err)
+	}
+	return c.Status(http.StatusOK).SendString("success")
+}
+
+func secretDelete(c *fiber.Ctx) error {
+	if Cfg.SecretsStore == nil {
+		return fiber.NewError(http.StatusNotFound, ErrSecretsStoreDisabled.Error())
+	}
+	if err := Cfg.SecretsStore.Delete(c.Params("secret")); err != nil {
+		return secretsError(err)
+	}
+	return c.Status(http.StatusOK).SendString("success")
+}
@@ -0,0 +1,115 @@
+package xrmcontroller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xrm-tech/xrm-controller/ovirt"
+)
+
+var (
+	ErrShuttingDown = errors.New("controller is shutting down")
+
+	operations = runningOperations{running: make(map[string]int)}
+)
+
+// runningOperations track running mutating requests (operations are executed while request is served)
+type runningOperations struct {
+	lock     sync.Mutex
+	running  map[string]int // count by route path
+	n        int
+	draining bool
+	idle     chan struct{} // closed when no running operations after drain start
+}
+
+func (o *runningOperations) begin(p string) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.draining {
+		return false
+	}
+	o.running[p]++
+	o.n++
+	return true
+}
+
+func (o *runningOperations) end(p string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.running[p]--; o.running[p] == 0 {
+		delete(o.running, p)
+	}
+	o.n--
+	if o.n == 0 && o.idle != nil {
+		close(o.idle)
+		o.idle = nil
+	}
+}
+
+// trackOperations reject new operations while shutting down and track running operations (read-only routes are not tracked)
+func trackOperations(c *fiber.Ctx) error {
+	if isReadOnlyRoute(c.Path()) {
+		return c.Next()
+	}
+	// fiber strings are reused
+	p := strings.Clone(c.Path())
+	if !operations.begin(p) {
+		return fiber.NewError(http.StatusServiceUnavailable, ErrShuttingDown.Error())
+	}
+	defer operations.end(p)
+
+	return c.Next()
+}
+
+// Draining return true if controller is shutting down (new operations are rejected)
+func Draining() bool {
+	operations.lock.Lock()
+	defer operations.lock.Unlock()
+
+	return operations.draining
+}
+
+// RunningOperations return running operations (route paths)
+func RunningOperations() []string {
+	operations.lock.Lock()
+	defer operations.lock.Unlock()
+
+	running := make([]string, 0, len(operations.running))
+	for p := range operations.running {
+		running = append(running, p)
+	}
+	sort.Strings(running)
+	return running
+}
+
+// Drain stop accepting new operations, cancel queued operations and wait for running operations completion (or ctx done)
+func Drain(ctx context.Context) error {
+	// queued operations are not started after drain start
+	ovirt.CloseQueue()
+
+	operations.lock.Lock()
+	operations.draining = true
+	if operations.n == 0 {
+		operations.lock.Unlock()
+		return nil
+	}
+	if operations.idle == nil {
+		operations.idle = make(chan struct{})
+	}
+	idle := operations.idle
+	operations.lock.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
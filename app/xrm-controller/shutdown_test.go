@@ -0,0 +1,88 @@
+package xrmcontroller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDrain(t *testing.T) {
+	defer func() { operations = runningOperations{running: make(map[string]int)} }()
+
+	release := make(chan struct{})
+	app := fiber.New()
+	app.Use(trackOperations)
+	app.Get("/ovirt/failover/:name", func(c *fiber.Ctx) error {
+		<-release
+		return c.SendString("success")
+	})
+	app.Get("/metrics", func(c *fiber.Ctx) error {
+		return c.SendString("metrics")
+	})
+
+	result := make(chan int, 1)
+	go func() {
+		resp, err := app.Test(httptest.NewRequest("GET", "/ovirt/failover/test", nil), -1)
+		if err != nil {
+			t.Error(err)
+			result <- 0
+			return
+		}
+		result <- resp.StatusCode
+	}()
+	for i := 0; i < 100 && len(RunningOperations()) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if running := RunningOperations(); !reflect.DeepEqual(running, []string{"/ovirt/failover/test"}) {
+		t.Fatalf("RunningOperations() = %v", running)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if err := Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Drain() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !Draining() {
+		t.Error("Draining() = false")
+	}
+
+	// new operations are rejected, read-only routes are served
+	resp, err := app.Test(httptest.NewRequest("GET", "/ovirt/failover/test2", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("operation while draining status = %d", resp.StatusCode)
+	}
+	if resp, err = app.Test(httptest.NewRequest("GET", "/metrics", nil), -1); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("read-only route while draining status = %d", resp.StatusCode)
+	}
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- Drain(context.Background())
+	}()
+	close(release)
+	if code := <-result; code != http.StatusOK {
+		t.Errorf("running operation status = %d", code)
+	}
+	select {
+	case err = <-drained:
+		if err != nil {
+			t.Errorf("Drain() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Drain() not completed")
+	}
+	if running := RunningOperations(); len(running) != 0 {
+		t.Errorf("RunningOperations() after drain = %v", running)
+	}
+}
@@ -0,0 +1,289 @@
+package xrmcontroller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/youmark/pkcs8"
+)
+
+var (
+	ErrTLSKeyPair      = errors.New("TLS require set key and cert")
+	ErrTLSClientCA     = errors.New("client CA bundle not contain certificates")
+	ErrCertUserInvalid = errors.New("certificate user is invalid (username:subject)")
+	ErrClientCANoTLS   = errors.New("client certificate verification require TLS key and cert")
+	ErrTLSKeyInvalid   = errors.New("TLS key is not in PEM format")
+	ErrTLSKeyPassword  = errors.New("TLS key is encrypted, password required")
+)
+
+// TLSEnabled check TLS settings
+func TLSEnabled() (bool, error) {
+	hasCert := Cfg.TLSCert != "" || len(Cfg.TLSCertPEM) > 0
+	hasKey := Cfg.TLSKey != "" || len(Cfg.TLSKeyPEM) > 0
+	if !hasCert && !hasKey {
+		if Cfg.TLSClientCA != "" {
+			return false, ErrClientCANoTLS
+		}
+		return false, nil
+	}
+	if !hasCert || !hasKey {
+		return false, ErrTLSKeyPair
+	}
+	return true, nil
+}
+
+// decryptKey decrypt password protected PEM key (PKCS#8 or legacy OpenSSL encrypted PEM)
+func decryptKey(keyPEM []byte, password string) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, ErrTLSKeyInvalid
+	}
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		if password == "" {
+			return nil, ErrTLSKeyPassword
+		}
+		key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+	//nolint:staticcheck // legacy encryption is insecure, but still used for existing keys
+	if x509.IsEncryptedPEMBlock(block) {
+		if password == "" {
+			return nil, ErrTLSKeyPassword
+		}
+		//nolint:staticcheck
+		der, err := x509.DecryptPEMBlock(block, []byte(password))
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+	}
+	return keyPEM, nil
+}
+
+// loadKeyPair load certificate and key (PEM content has priority over files)
+func loadKeyPair() (tls.Certificate, error) {
+	var (
+		certPEM, keyPEM []byte
+		err             error
+	)
+	if len(Cfg.TLSCertPEM) > 0 {
+		certPEM = Cfg.TLSCertPEM
+	} else if certPEM, err = os.ReadFile(Cfg.TLSCert); err != nil {
+		return tls.Certificate{}, err
+	}
+	if len(Cfg.TLSKeyPEM) > 0 {
+		keyPEM = Cfg.TLSKeyPEM
+	} else if keyPEM, err = os.ReadFile(Cfg.TLSKey); err != nil {
+		return tls.Certificate{}, err
+	}
+	if keyPEM, err = decryptKey(keyPEM, Cfg.TLSKeyPassword); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+func buildTLSConfig() (*tls.Config, error) {
+	cert, err := loadKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if Cfg.TLSClientCA != "" {
+		b, err := os.ReadFile(Cfg.TLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, ErrTLSClientCA
+		}
+		config.ClientCAs = pool
+		if Cfg.TLSClientCertOptional {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		} else {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return config, nil
+}
+
+// tlsReloader hold current TLS config, rebuilded on cert/key/client CA files change
+type tlsReloader struct {
+	lock   sync.RWMutex
+	config *tls.Config
+	mtimes []time.Time
+}
+
+var tlsReload tlsReloader
+
+// tlsFiles return watched files (not set or set with PEM content are skipped)
+func tlsFiles() []string {
+	files := make([]string, 0, 3)
+	if len(Cfg.TLSCertPEM) == 0 && Cfg.TLSCert != "" {
+		files = append(files, Cfg.TLSCert)
+	}
+	if len(Cfg.TLSKeyPEM) == 0 && Cfg.TLSKey != "" {
+		files = append(files, Cfg.TLSKey)
+	}
+	if Cfg.TLSClientCA != "" {
+		files = append(files, Cfg.TLSClientCA)
+	}
+	return files
+}
+
+func fileMtimes(files []string) []time.Time {
+	mtimes := make([]time.Time, len(files))
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			mtimes[i] = info.ModTime()
+		}
+	}
+	return mtimes
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *tlsReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.config, nil
+}
+
+// reload rebuild TLS config if files changed, on error previous config is used
+func (r *tlsReloader) reload() (bool, error) {
+	mtimes := fileMtimes(tlsFiles())
+
+	r.lock.RLock()
+	changed := !equalTimes(mtimes, r.mtimes)
+	r.lock.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	config, err := buildTLSConfig()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// don't retry broken files until next change
+	r.mtimes = mtimes
+	if err != nil {
+		return false, err
+	}
+	r.config = config
+	return true, nil
+}
+
+// TLSConfig build server TLS config, with client certificates verification if client CA bundle is set.
+// Certificate, key and client CA bundle are reloaded by TLSWatch.
+func TLSConfig() (*tls.Config, error) {
+	mtimes := fileMtimes(tlsFiles())
+	config, err := buildTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsReload.lock.Lock()
+	tlsReload.config = config
+	tlsReload.mtimes = mtimes
+	tlsReload.lock.Unlock()
+
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: tlsReload.getConfigForClient,
+	}, nil
+}
+
+// TLSWatch check cert/key/client CA files for changes and reload it, until stop is closed
+func TLSWatch(interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 || len(tlsFiles()) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if reloaded, err := tlsReload.reload(); err != nil {
+				Cfg.Logger.Error().Str("logger", "tls").Strs("files", tlsFiles()).Err(err).Msg("TLS reload failed, previous certificate is used")
+			} else if reloaded {
+				Cfg.Logger.Info().Str("logger", "tls").Strs("files", tlsFiles()).Msg("TLS reloaded")
+			}
+		}
+	}
+}
+
+// ParseCertUsers parse certificate subject to username map (username:subject,...), subject in RFC 2253 format, like CN=client,O=Example
+func ParseCertUsers(users []string) (map[string]string, error) {
+	certUsers := make(map[string]string)
+	for _, user := range users {
+		if user == "" {
+			// skip empty
+			continue
+		}
+		username, subject, _ := strings.Cut(user, ":")
+		if username == "" || subject == "" {
+			return nil, ErrCertUserInvalid
+		}
+		certUsers[subject] = username
+	}
+	return certUsers, nil
+}
+
+// certUsername map verified client certificate to username (by subject if mapping is set, or by common name)
+func certUsername(cert *x509.Certificate) (string, bool) {
+	if len(Cfg.CertUsers) > 0 {
+		username, ok := Cfg.CertUsers[cert.Subject.String()]
+		return username, ok
+	}
+	return cert.Subject.CommonName, cert.Subject.CommonName != ""
+}
+
+// certAuth authenticate user by verified client certificate, unauthenticated requests are passed to basic auth
+func certAuth(c *fiber.Ctx) error {
+	if state := c.Context().TLSConnectionState(); state != nil && len(state.VerifiedChains) > 0 {
+		cert := state.VerifiedChains[0][0]
+		c.Locals("cert_subject", cert.Subject.String())
+		if username, ok := certUsername(cert); ok {
+			c.Locals("username", username)
+		}
+	}
+	return c.Next()
+}
+
+// certAuthenticated skip basic auth for users, authenticated with client certificate
+func certAuthenticated(c *fiber.Ctx) bool {
+	return username(c) != ""
+}
@@ -0,0 +1,149 @@
+package xrmcontroller
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/xrm-tech/xrm-controller/pkg/tests"
+	"github.com/youmark/pkcs8"
+)
+
+func Test_decryptKey(t *testing.T) {
+	ca, err := tests.GenerateCert(nil, "CA", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(ca.Key)
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := pkcs8.ConvertPrivateKeyToPKCS8(key, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8PEM := pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der})
+
+	//nolint:staticcheck
+	legacyBlock, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", block.Bytes, []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyPEM := pem.EncodeToMemory(legacyBlock)
+
+	tests := []struct {
+		name     string
+		keyPEM   []byte
+		password string
+		wantErr  bool
+	}{
+		{name: "plain", keyPEM: ca.Key},
+		{name: "pkcs8", keyPEM: pkcs8PEM, password: "secret"},
+		{name: "pkcs8 without password", keyPEM: pkcs8PEM, wantErr: true},
+		{name: "pkcs8 invalid password", keyPEM: pkcs8PEM, password: "invalid", wantErr: true},
+		{name: "legacy", keyPEM: legacyPEM, password: "secret"},
+		{name: "legacy without password", keyPEM: legacyPEM, wantErr: true},
+		{name: "not PEM", keyPEM: []byte("key"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptKey(tt.keyPEM, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decryptKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if _, err = tls.X509KeyPair(ca.Cert, got); err != nil {
+					t.Errorf("decryptKey() = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func Test_tlsReloader(t *testing.T) {
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, err := tests.GenerateCert(nil, "CA", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert1, err := tests.GenerateCert(ca, "localhost", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Cfg.TLSCert, Cfg.TLSKey, err = cert1.WriteFiles(dir, "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		Cfg.TLSCert = ""
+		Cfg.TLSKey = ""
+	}()
+
+	config, err := TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getCert := func() []byte {
+		c, err := config.GetConfigForClient(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Certificates[0].Certificate[0]
+	}
+	want, _ := pem.Decode(cert1.Cert)
+	if string(getCert()) != string(want.Bytes) {
+		t.Fatal("TLSConfig() return unexpected certificate")
+	}
+
+	if reloaded, err := tlsReload.reload(); reloaded || err != nil {
+		t.Fatalf("tlsReloader.reload() without changes = %v, %v", reloaded, err)
+	}
+
+	// broken key, previous config must be used
+	mtime := time.Now().Add(time.Second)
+	if err = os.WriteFile(Cfg.TLSKey, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes(Cfg.TLSKey, mtime, mtime)
+	if reloaded, err := tlsReload.reload(); reloaded || err == nil {
+		t.Fatalf("tlsReloader.reload() with broken key = %v, %v", reloaded, err)
+	}
+	if string(getCert()) != string(want.Bytes) {
+		t.Fatal("broken key must not replace certificate")
+	}
+
+	cert2, err := tests.GenerateCert(ca, "localhost", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = cert2.WriteFiles(dir, "server"); err != nil {
+		t.Fatal(err)
+	}
+	mtime = mtime.Add(time.Second)
+	_ = os.Chtimes(Cfg.TLSCert, mtime, mtime)
+	_ = os.Chtimes(Cfg.TLSKey, mtime, mtime)
+	if reloaded, err := tlsReload.reload(); !reloaded || err != nil {
+		t.Fatalf("tlsReloader.reload() = %v, %v", reloaded, err)
+	}
+	want, _ = pem.Decode(cert2.Cert)
+	if string(getCert()) != string(want.Bytes) {
+		t.Fatal("certificate not reloaded")
+	}
+
+	if files := tlsFiles(); len(files) != 2 || files[0] != path.Join(dir, "server.crt") {
+		t.Errorf("tlsFiles() = %v", files)
+	}
+}
@@ -0,0 +1,66 @@
+package xrmcontroller
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xrm-tech/xrm-controller/pkg/tracing"
+)
+
+// headerCarrier is a propagation carrier for fiber request headers
+type headerCarrier struct {
+	c *fiber.Ctx
+}
+
+func (h headerCarrier) Get(key string) string {
+	return h.c.Get(key)
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h.c.Request().Header.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, 8)
+	h.c.Request().Header.VisitAll(func(k, _ []byte) {
+		keys = append(keys, string(k))
+	})
+	return keys
+}
+
+var _ propagation.TextMapCarrier = headerCarrier{}
+
+// traced start span for request (parent is extracted from traceparent header), span context is passed to handlers with UserContext
+func traced(c *fiber.Ctx) error {
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{c})
+	method := strings.Clone(c.Method())
+	ctx, span := tracing.Start(ctx, "HTTP "+method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		semconv.HTTPMethod(method),
+		semconv.HTTPTarget(string(c.Request().RequestURI())),
+	))
+	c.SetUserContext(ctx)
+
+	err := c.Next()
+
+	// route pattern is known only after routing
+	route := c.Route().Path
+	span.SetName("HTTP " + method + " " + route)
+	code := statusCode(c, err)
+	span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPStatusCode(code))
+	if username := username(c); username != "" {
+		span.SetAttributes(attribute.String("enduser.id", strings.Clone(username)))
+	}
+	if code >= 500 {
+		tracing.End(span, err)
+	} else {
+		span.End()
+	}
+
+	return err
+}
@@ -0,0 +1,34 @@
+package xrmcontroller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	ErrWebhooksDisabled = errors.New("webhooks are disabled")
+
+	webhookDeliveriesLimit = 1000
+)
+
+// webhookDeliveries return last webhook delivery log records (limit parameter, default 1000)
+func webhookDeliveries(c *fiber.Ctx) error {
+	if Cfg.Webhooks == nil {
+		return fiber.NewError(http.StatusNotFound, ErrWebhooksDisabled.Error())
+	}
+	limit := webhookDeliveriesLimit
+	if s := c.Query("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 {
+			return fiber.NewError(http.StatusBadRequest, "limit is invalid")
+		}
+	}
+	deliveries, err := Cfg.Webhooks.Deliveries(limit)
+	if err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+	return c.Status(http.StatusOK).JSON(deliveries)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	xrm "github.com/xrm-tech/xrm-controller/app/xrm-controller"
+	"github.com/xrm-tech/xrm-controller/pkg/tests"
+)
+
+func TestProbes(t *testing.T) {
+	var err error
+
+	if xrm.Cfg.Listen, err = tests.GetFreeLocalAddr(); err != nil {
+		t.Fatal(err)
+	}
+	if xrm.Cfg.StoreDir, err = os.MkdirTemp("", "xrm-controller"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(xrm.Cfg.StoreDir)
+	// without template dir
+	xrm.Cfg.OVirtStoreDir = xrm.Cfg.StoreDir
+
+	xrm.Cfg.Logger = zerolog.New(os.Stdout)
+	xrm.Cfg.Users = map[string]string{"test1": "password1"}
+	xrm.Cfg.WriteACL = xrm.IPACL{Deny: mustParseCIDRs(t, "127.0.0.0/8")}
+	xrm.Cfg.ReadACL = xrm.Cfg.WriteACL
+	defer func() {
+		xrm.Cfg.WriteACL = xrm.IPACL{}
+		xrm.Cfg.ReadACL = xrm.IPACL{}
+	}()
+	app := xrm.RouterInit()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		wg.Done()
+		_ = app.Listen(xrm.Cfg.Listen)
+	}()
+	wg.Wait()
+	defer func() { _ = app.Shutdown() }()
+	time.Sleep(time.Millisecond * 10)
+
+	// probes are available without auth and not filtered by access lists
+	if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/healthz", "", "", http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/readyz", "", "", http.StatusServiceUnavailable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r xrm.Readiness
+	if err = json.Unmarshal(body, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != xrm.CheckFailed {
+		t.Errorf("/readyz status = %q, want %q", r.Status, xrm.CheckFailed)
+	}
+	want := map[string]xrm.CheckStatus{
+		"store_dir":       xrm.CheckOK,
+		"ovirt_store_dir": xrm.CheckOK,
+		"ovirt_template":  xrm.CheckFailed,
+	}
+	for _, c := range r.Checks {
+		if status, ok := want[c.Name]; ok && status != c.Status {
+			t.Errorf("/readyz check %q = %q (%s), want %q", c.Name, c.Status, c.Error, status)
+		}
+	}
+	if len(r.Checks) != 5 {
+		t.Errorf("/readyz checks = %+v", r.Checks)
+	}
+
+	// other routes are filtered
+	if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/metrics", "test1", "password1", http.StatusForbidden); err != nil {
+		t.Fatal(err)
+	}
+	// recovery details are not available on probe address
+	if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/status", "", "", http.StatusForbidden); err != nil {
+		t.Fatal(err)
+	}
+	xrm.Cfg.ReadACL = xrm.IPACL{}
+	if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/status", "", "", http.StatusUnauthorized); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/status", "test1", "password1", http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustParseCIDRs(t *testing.T, s ...string) []*net.IPNet {
+	networks, err := xrm.ParseCIDRs(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return networks
+}
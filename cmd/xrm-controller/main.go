@@ -1,10 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
+	"math"
+	"net"
 	"os"
+	"os/signal"
 	"path"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/msaf1980/go-clipper"
 	"github.com/rs/zerolog"
@@ -12,13 +20,43 @@ import (
 
 	xrm "github.com/xrm-tech/xrm-controller/app/xrm-controller"
 	xrmcontroller "github.com/xrm-tech/xrm-controller/app/xrm-controller"
+	"github.com/xrm-tech/xrm-controller/ovirt"
+	"github.com/xrm-tech/xrm-controller/pkg/audit"
+	"github.com/xrm-tech/xrm-controller/pkg/jobs"
+	"github.com/xrm-tech/xrm-controller/pkg/mail"
+	"github.com/xrm-tech/xrm-controller/pkg/secrets"
+	"github.com/xrm-tech/xrm-controller/pkg/tracing"
 	"github.com/xrm-tech/xrm-controller/pkg/utils"
+	"github.com/xrm-tech/xrm-controller/pkg/webhook"
 )
 
 var (
 	BuildVersion string
 	users        []string
+	roles        []string
+	readAllow    []string
+	readDeny     []string
+	writeAllow   []string
+	writeDeny    []string
+	proxies      []string
+	certUsers    []string
 	debug        bool
+
+	bodyLimit       int64
+	keyPasswordFile string
+	secretsDir      string
+	secretsKeyFile  string
+	traceConfig     tracing.Config
+	webhooksFile    string
+	webhookConfig   webhook.Config
+	mailFile        string
+	playbookFile    string
+	executorConfig  ovirt.ExecutorConfig
+	logRetention    ovirt.LogRetention
+	jobsRetention   jobs.Retention
+	shutdownTimeout time.Duration
+	queueConfig     ovirt.QueueConfig
+	queuePriorities []string
 )
 
 func main() {
@@ -30,15 +68,97 @@ func main() {
 		AttachEnv("XRM_CONTROLLER_DIR")
 	rootCmd.AddString("listen", "l", ":8080", &xrm.Cfg.Listen, "listen address").
 		AttachEnv("XRM_CONTROLLER_LISTEN")
-	// TODO: password protected key, get cert/key files from external storage or env vars
+	rootCmd.AddInt64NFromString("body-limit", "", "1M", &bodyLimit, "max request body size (K, M suffixes are allowed)").
+		AttachEnv("XRM_CONTROLLER_BODY_LIMIT")
+	// TODO: get cert/key files from external storage
 	rootCmd.AddString("key", "k", "", &xrm.Cfg.TLSKey, "TLS private key").
 		AttachEnv("XRM_CONTROLLER_TLS_KEY")
 	rootCmd.AddString("cert", "c", "", &xrm.Cfg.TLSCert, "TLS certificate").
 		AttachEnv("XRM_CONTROLLER_TLS_CERT")
+	rootCmd.AddString("key-password-file", "", "", &keyPasswordFile, "TLS private key password file (or set XRM_CONTROLLER_TLS_KEY_PASSWORD)").
+		AttachEnv("XRM_CONTROLLER_TLS_KEY_PASSWORD_FILE")
+	rootCmd.AddDuration("tls-reload", "", time.Minute, &xrm.Cfg.TLSReload, "TLS cert/key/client CA files check interval for reload (0 for disable)").
+		AttachEnv("XRM_CONTROLLER_TLS_RELOAD")
+	rootCmd.AddString("client-ca", "", "", &xrm.Cfg.TLSClientCA, "CA bundle for client certificates verification").
+		AttachEnv("XRM_CONTROLLER_TLS_CLIENT_CA")
+	rootCmd.AddFlag("client-cert-optional", "", &xrm.Cfg.TLSClientCertOptional, "verify client certificate only if given (else basic auth is used)").
+		AttachEnv("XRM_CONTROLLER_TLS_CLIENT_CERT_OPTIONAL")
+	rootCmd.AddStringArray("cert-user", "", []string{}, &certUsers, "client certificate subject map to user (username1:CN=client1,O=Org,...), by default common name is used as username").
+		AttachEnv("XRM_CONTROLLER_CERT_USERS")
 	// TODO: may be API key for simplify or crypted passwords for security
 	// no default password, it's security hole
 	rootCmd.AddStringArray("user", "u", []string{}, &users, "users (username1:password1,...)").
 		AttachEnv("XRM_CONTROLLER_USERS")
+	rootCmd.AddStringArray("role", "r", []string{}, &roles, "user roles (username1:role[:config_pattern],...), roles: viewer, operator, admin").
+		AttachEnv("XRM_CONTROLLER_ROLES")
+	rootCmd.AddStringArray("read-allow", "", []string{}, &readAllow, "allowed networks for read-only routes (CIDR or address, any if empty)").
+		AttachEnv("XRM_CONTROLLER_READ_ALLOW")
+	rootCmd.AddStringArray("read-deny", "", []string{}, &readDeny, "denied networks for read-only routes (CIDR or address)").
+		AttachEnv("XRM_CONTROLLER_READ_DENY")
+	rootCmd.AddStringArray("write-allow", "", []string{}, &writeAllow, "allowed networks for mutating routes (CIDR or address, any if empty)").
+		AttachEnv("XRM_CONTROLLER_WRITE_ALLOW")
+	rootCmd.AddStringArray("write-deny", "", []string{}, &writeDeny, "denied networks for mutating routes (CIDR or address)").
+		AttachEnv("XRM_CONTROLLER_WRITE_DENY")
+	rootCmd.AddStringArray("trusted-proxy", "", []string{}, &proxies, "trusted proxies networks, client address is taken from X-Forwarded-For (CIDR or address)").
+		AttachEnv("XRM_CONTROLLER_TRUSTED_PROXIES")
+	rootCmd.AddFlag("approval", "", &xrm.Cfg.Approval, "failover require approval by another user").
+		AttachEnv("XRM_CONTROLLER_APPROVAL")
+	rootCmd.AddDuration("approval-timeout", "", time.Minute*30, &xrm.Cfg.ApprovalTimeout, "failover approval timeout").
+		AttachEnv("XRM_CONTROLLER_APPROVAL_TIMEOUT")
+	rootCmd.AddInt("queue-depth", "", 0, &queueConfig.MaxDepth, "max queued operations, while another operation in progress (queue is disabled if 0)").
+		AttachEnv("XRM_CONTROLLER_QUEUE_DEPTH")
+	rootCmd.AddStringArray("queue-priority", "", []string{}, &queuePriorities, "operation priority in queue (operation:priority, higher is started first)").
+		AttachEnv("XRM_CONTROLLER_QUEUE_PRIORITIES")
+	rootCmd.AddDuration("shutdown-timeout", "", time.Minute*10, &shutdownTimeout, "max wait for running operations completion on shutdown").
+		AttachEnv("XRM_CONTROLLER_SHUTDOWN_TIMEOUT")
+	rootCmd.AddString("secrets-dir", "", "", &secretsDir, "dir with secret files for file: password references (disabled if empty)").
+		AttachEnv("XRM_CONTROLLER_SECRETS_DIR")
+	rootCmd.AddString("secrets-key-file", "", "", &secretsKeyFile, "secrets store encryption key file for store: password references (disabled if empty)").
+		AttachEnv("XRM_CONTROLLER_SECRETS_KEY_FILE")
+	rootCmd.AddString("webhooks", "", "", &webhooksFile, "webhooks config (JSON), disabled if empty").
+		AttachEnv("XRM_CONTROLLER_WEBHOOKS")
+	rootCmd.AddInt("webhook-retries", "", 5, &webhookConfig.Retries, "webhook delivery retries").
+		AttachEnv("XRM_CONTROLLER_WEBHOOK_RETRIES")
+	rootCmd.AddDuration("webhook-timeout", "", time.Second*10, &webhookConfig.Timeout, "webhook request timeout").
+		AttachEnv("XRM_CONTROLLER_WEBHOOK_TIMEOUT")
+	rootCmd.AddDuration("webhook-backoff", "", time.Second, &webhookConfig.Backoff, "webhook delivery first retry delay (doubled for next retries, up to 5m)").
+		AttachEnv("XRM_CONTROLLER_WEBHOOK_BACKOFF")
+	rootCmd.AddString("executor", "", "local", &executorConfig.Name, "playbook executor: local (ansible-playbook), ansible-runner or container").
+		AttachEnv("XRM_CONTROLLER_EXECUTOR")
+	rootCmd.AddString("container-runtime", "", "podman", &executorConfig.Container.Runtime, "container executor runtime command (podman or docker)").
+		AttachEnv("XRM_CONTROLLER_CONTAINER_RUNTIME")
+	rootCmd.AddString("container-image", "", "", &executorConfig.Container.Image, "container executor default image (with ansible-core and ovirt.ovirt collection), can be overridden per config with playbook config").
+		AttachEnv("XRM_CONTROLLER_CONTAINER_IMAGE")
+	rootCmd.AddString("container-network", "", "host", &executorConfig.Container.Network, "container executor network").
+		AttachEnv("XRM_CONTROLLER_CONTAINER_NETWORK")
+	rootCmd.AddStringArray("container-arg", "", []string{}, &executorConfig.Container.Args, "container executor extra runtime run arguments (like --userns=keep-id)").
+		AttachEnv("XRM_CONTROLLER_CONTAINER_ARGS")
+	rootCmd.AddString("playbook-config", "", "", &playbookFile, "ansible-playbook settings config (JSON): defaults, per-operation/per-config overrides and per-request limits").
+		AttachEnv("XRM_CONTROLLER_PLAYBOOK_CONFIG")
+	rootCmd.AddInt("playbook-verbosity", "", ovirt.DefaultVerbosity, &ovirt.DefaultVerbosity, "ansible-playbook default verbosity (-v flags count)").
+		AttachEnv("XRM_CONTROLLER_PLAYBOOK_VERBOSITY")
+	rootCmd.AddDuration("playbook-timeout", "", ovirt.DefaultTimeout, &ovirt.DefaultTimeout, "ansible-playbook default timeout").
+		AttachEnv("XRM_CONTROLLER_PLAYBOOK_TIMEOUT")
+	rootCmd.AddInt("log-keep", "", 10, &logRetention.Keep, "playbook logs history: kept runs per config and operation (unlimited if 0)").
+		AttachEnv("XRM_CONTROLLER_LOG_KEEP")
+	rootCmd.AddDuration("log-max-age", "", 0, &logRetention.MaxAge, "playbook logs history: max run age (unlimited if 0)").
+		AttachEnv("XRM_CONTROLLER_LOG_MAX_AGE")
+	rootCmd.AddFlag("log-compress", "", &logRetention.Compress, "playbook logs history: gzip compression").
+		AttachEnv("XRM_CONTROLLER_LOG_COMPRESS")
+	rootCmd.AddInt("jobs-keep", "", 10000, &jobsRetention.Keep, "jobs history: kept jobs (unlimited if 0, queued and running jobs are always kept)").
+		AttachEnv("XRM_CONTROLLER_JOBS_KEEP")
+	rootCmd.AddDuration("jobs-max-age", "", 0, &jobsRetention.MaxAge, "jobs history: max job age (unlimited if 0)").
+		AttachEnv("XRM_CONTROLLER_JOBS_MAX_AGE")
+	rootCmd.AddString("mail", "", "", &mailFile, "email notifications config (JSON), disabled if empty").
+		AttachEnv("XRM_CONTROLLER_MAIL")
+	rootCmd.AddString("trace-exporter", "", "none", &traceConfig.Exporter, "tracing exporter: none, otlp (OTLP over HTTP) or file (JSON, for offline environments)").
+		AttachEnv("XRM_CONTROLLER_TRACE_EXPORTER")
+	rootCmd.AddString("trace-endpoint", "", "", &traceConfig.Endpoint, "OTLP collector address (host:port), OTEL_EXPORTER_OTLP_* variables are used if empty").
+		AttachEnv("XRM_CONTROLLER_TRACE_ENDPOINT")
+	rootCmd.AddFlag("trace-insecure", "", &traceConfig.Insecure, "disable TLS for OTLP collector").
+		AttachEnv("XRM_CONTROLLER_TRACE_INSECURE")
+	rootCmd.AddString("trace-file", "", "", &traceConfig.File, "spans file for file exporter").
+		AttachEnv("XRM_CONTROLLER_TRACE_FILE")
 	rootCmd.AddVersionHelper("version", "v", registry.Description, BuildVersion)
 	rootCmd.AddFlag("debug", "", &debug, "debug logging").
 		AttachEnv("XRM_CONTROLLER_DEBUG")
@@ -55,6 +175,10 @@ func main() {
 	}
 
 	xrm.Cfg.Logger = zerolog.New(os.Stdout)
+	if bodyLimit <= 0 || bodyLimit > math.MaxInt32 {
+		log.Fatal().Int64("body_limit", bodyLimit).Msg("body limit is invalid")
+	}
+	xrm.Cfg.BodyLimit = int(bodyLimit)
 	xrm.Cfg.Users = make(map[string]string)
 	for _, user := range users {
 		username, password, _ := strings.Cut(user, ":")
@@ -64,6 +188,45 @@ func main() {
 		}
 	}
 
+	var err error
+	if xrm.Cfg.Roles, err = xrm.ParseRoles(roles); err != nil {
+		log.Fatal().Err(err).Msg("roles")
+	}
+	if xrm.Cfg.CertUsers, err = xrm.ParseCertUsers(certUsers); err != nil {
+		log.Fatal().Err(err).Msg("cert-user")
+	}
+	if xrm.Cfg.TLSClientCA == "" || len(xrm.Cfg.CertUsers) > 0 {
+		// with client certificates and without subjects map any common name can be used as username
+		knownUsers := make(map[string]bool)
+		for username := range xrm.Cfg.Users {
+			knownUsers[username] = true
+		}
+		for _, username := range xrm.Cfg.CertUsers {
+			knownUsers[username] = true
+		}
+		for username := range xrm.Cfg.Roles {
+			if !knownUsers[username] {
+				log.Fatal().Str("username", username).Msg("role defined for unknown user")
+			}
+		}
+	}
+
+	if xrm.Cfg.ReadACL.Allow, err = xrm.ParseCIDRs(readAllow); err != nil {
+		log.Fatal().Err(err).Msg("read-allow")
+	}
+	if xrm.Cfg.ReadACL.Deny, err = xrm.ParseCIDRs(readDeny); err != nil {
+		log.Fatal().Err(err).Msg("read-deny")
+	}
+	if xrm.Cfg.WriteACL.Allow, err = xrm.ParseCIDRs(writeAllow); err != nil {
+		log.Fatal().Err(err).Msg("write-allow")
+	}
+	if xrm.Cfg.WriteACL.Deny, err = xrm.ParseCIDRs(writeDeny); err != nil {
+		log.Fatal().Err(err).Msg("write-deny")
+	}
+	if xrm.Cfg.TrustedProxies, err = xrm.ParseCIDRs(proxies); err != nil {
+		log.Fatal().Err(err).Msg("trusted-proxy")
+	}
+
 	if xrm.Cfg.StoreDir == "" {
 		log.Fatal().Msg("store dir can not be empty")
 	}
@@ -73,13 +236,215 @@ func main() {
 
 	xrm.Cfg.OVirtStoreDir = path.Join(xrm.Cfg.StoreDir, "ovirt")
 
+	xrm.Cfg.Secrets = secrets.Resolver{"env": secrets.EnvProvider{}}
+	if secretsDir != "" {
+		if !utils.DirExists(secretsDir) {
+			log.Fatal().Str("secrets_dir", secretsDir).Msg("secrets dir not exist")
+		}
+		xrm.Cfg.Secrets["file"] = secrets.FileProvider{Dir: secretsDir}
+	}
+	if secretsKeyFile != "" {
+		key, err := os.ReadFile(secretsKeyFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("secrets-key-file")
+		}
+		if xrm.Cfg.SecretsStore, err = secrets.NewStore(path.Join(xrm.Cfg.StoreDir, "secrets"), bytes.TrimRight(key, "\r\n")); err != nil {
+			log.Fatal().Err(err).Msg("secrets store")
+		}
+		xrm.Cfg.Secrets["store"] = xrm.Cfg.SecretsStore
+	}
+
+	if xrm.Cfg.Audit, err = audit.Open(path.Join(xrm.Cfg.StoreDir, "audit.log")); err != nil {
+		log.Fatal().Err(err).Msg("audit log")
+	}
+	if err = xrm.Cfg.Audit.Recovered(); err != nil {
+		log.Error().Err(err).Msg("audit log recovered")
+	}
+	if _, err = xrm.Cfg.Audit.Verify(); err != nil {
+		log.Error().Err(err).Msg("audit log hash chain verification failed")
+	}
+
+	if xrm.Cfg.Jobs, err = jobs.Open(path.Join(xrm.Cfg.StoreDir, "jobs.jsonl"), jobsRetention); err != nil {
+		log.Fatal().Err(err).Msg("jobs history")
+	}
+	if err = xrm.Cfg.Jobs.Recovered(); err != nil {
+		log.Error().Err(err).Msg("jobs history recovered")
+	}
+
+	if !ovirt.ValidateVerbosity(ovirt.DefaultVerbosity) {
+		log.Fatal().Int("playbook_verbosity", ovirt.DefaultVerbosity).Msg("playbook verbosity is invalid")
+	}
+	executor, err := ovirt.NewExecutor(executorConfig)
+	if err != nil {
+		log.Fatal().Str("executor", executorConfig.Name).Err(err).Msg("executor")
+	}
+	ovirt.SetLogger(xrm.Cfg.Logger)
+	ovirt.SetExecutor(executor)
+	ovirt.SetLogRetention(logRetention)
+	if queueConfig.Priorities, err = ovirt.ParsePriorities(queuePriorities); err != nil {
+		log.Fatal().Err(err).Msg("queue-priority")
+	}
+	if queueConfig.MaxDepth < 0 {
+		log.Fatal().Int("queue_depth", queueConfig.MaxDepth).Msg("queue depth is invalid")
+	}
+	ovirt.SetQueue(queueConfig)
+
+	expired, err := xrm.ExpireLostApprovals()
+	for _, a := range expired {
+		log.Warn().Str("id", a.ID).Str("operation", a.Operation).Str("name", a.Name).Msg("pending approval request lost on restart, expired")
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("approvals")
+	}
+
+	recovery, err := xrm.Recover()
+	for _, job := range recovery.Interrupted {
+		log.Warn().Str("id", job.ID).Str("operation", job.Operation).Str("name", job.Name).Str("username", job.Username).
+			Time("start", job.Start).Msg(job.Error)
+	}
+	for _, name := range recovery.StaleLocks {
+		log.Info().Str("name", name).Msg("stale config lock removed")
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("recovery")
+	}
+
+	if playbookFile != "" {
+		if xrm.Cfg.Playbook, err = ovirt.LoadPlaybookConfig(playbookFile); err != nil {
+			log.Fatal().Str("file", playbookFile).Err(err).Msg("playbook config")
+		}
+	}
+
+	if webhooksFile != "" {
+		hooks, err := webhook.LoadHooks(webhooksFile)
+		if err != nil {
+			log.Fatal().Str("file", webhooksFile).Err(err).Msg("webhooks")
+		}
+		for i := range hooks {
+			if hooks[i].SecretRef != "" {
+				if hooks[i].Secret, err = xrm.Cfg.Secrets.Resolve(hooks[i].SecretRef); err != nil {
+					log.Fatal().Str("url", hooks[i].URL).Err(err).Msg("webhook secret")
+				}
+			}
+		}
+		webhookConfig.MaxBackoff = time.Minute * 5
+		webhookConfig.LogFile = path.Join(xrm.Cfg.StoreDir, "webhooks.log")
+		webhookConfig.Logger = xrm.Cfg.Logger
+		if xrm.Cfg.Webhooks, err = webhook.New(hooks, webhookConfig); err != nil {
+			log.Fatal().Err(err).Msg("webhooks")
+		}
+		xrm.Cfg.Notifiers = append(xrm.Cfg.Notifiers, xrm.Cfg.Webhooks)
+	}
+
+	if mailFile != "" {
+		mailConfig, err := mail.LoadConfig(mailFile)
+		if err != nil {
+			log.Fatal().Str("file", mailFile).Err(err).Msg("mail")
+		}
+		if mailConfig.PasswordRef != "" {
+			if mailConfig.Password, err = xrm.Cfg.Secrets.Resolve(mailConfig.PasswordRef); err != nil {
+				log.Fatal().Str("server", mailConfig.Server).Err(err).Msg("mail password")
+			}
+		}
+		mailer, err := mail.New(mailConfig, xrm.Cfg.Logger)
+		if err != nil {
+			log.Fatal().Err(err).Msg("mail")
+		}
+		xrm.Cfg.Notifiers = append(xrm.Cfg.Notifiers, mailer)
+	}
+
+	// secrets from env, unset for not pass to ansible-playbook
+	xrm.Cfg.TLSCertPEM = []byte(os.Getenv("XRM_CONTROLLER_TLS_CERT_PEM"))
+	xrm.Cfg.TLSKeyPEM = []byte(os.Getenv("XRM_CONTROLLER_TLS_KEY_PEM"))
+	xrm.Cfg.TLSKeyPassword = os.Getenv("XRM_CONTROLLER_TLS_KEY_PASSWORD")
+	_ = os.Unsetenv("XRM_CONTROLLER_TLS_KEY_PEM")
+	_ = os.Unsetenv("XRM_CONTROLLER_TLS_KEY_PASSWORD")
+	if keyPasswordFile != "" {
+		b, err := os.ReadFile(keyPasswordFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("key-password-file")
+		}
+		xrm.Cfg.TLSKeyPassword = strings.TrimRight(string(b), "\r\n")
+	}
+
+	tlsEnabled, err := xrm.TLSEnabled()
+	if err != nil {
+		log.Fatal().Str("cert", xrm.Cfg.TLSCert).Str("key", xrm.Cfg.TLSKey).Str("client_ca", xrm.Cfg.TLSClientCA).Msg(err.Error())
+	}
+	var tlsConfig *tls.Config
+	if tlsEnabled {
+		if tlsConfig, err = xrm.TLSConfig(); err != nil {
+			log.Fatal().Str("cert", xrm.Cfg.TLSCert).Str("key", xrm.Cfg.TLSKey).Str("client_ca", xrm.Cfg.TLSClientCA).Err(err).Msg("TLS")
+		}
+	}
+
+	traceConfig.Version = BuildVersion
+	if err = tracing.Init(traceConfig); err != nil {
+		log.Fatal().Str("exporter", traceConfig.Exporter).Err(err).Msg("tracing")
+	}
+
 	app := xrmcontroller.RouterInit()
-	// TODO: implement ssl, basic auth and ip acl
-	if xrm.Cfg.TLSCert != "" && xrm.Cfg.TLSKey == "" {
-		log.Fatal().Err(app.ListenTLS(xrm.Cfg.Listen, xrm.Cfg.TLSCert, xrm.Cfg.TLSKey))
-	} else if xrm.Cfg.TLSCert == "" && xrm.Cfg.TLSKey == "" {
-		log.Fatal().Err(app.Listen(xrm.Cfg.Listen))
-	} else {
-		log.Fatal().Str("cert", xrm.Cfg.TLSCert).Str("key", xrm.Cfg.TLSKey).Msg("TLS require set key and cert")
+
+	ln, err := net.Listen("tcp", xrm.Cfg.Listen)
+	if err != nil {
+		log.Fatal().Err(err).Msg("listen")
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+		go xrm.TLSWatch(xrm.Cfg.TLSReload, nil)
+	}
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listener(ln)
+	}()
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	exitCode := 0
+	// shutdown context bound running operations and pending notifications waiting
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	select {
+	case err = <-listenErr:
+		log.Error().Err(err).Msg("listen")
+		exitCode = 1
+		ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	case sig := <-signals:
+		log.Info().Str("signal", sig.String()).Dur("timeout", shutdownTimeout).Strs("operations", xrm.RunningOperations()).
+			Msg("shutdown, waiting for running operations")
+		ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+		go func() {
+			// second signal interrupt waiting
+			<-signals
+			cancel()
+		}()
+		if err = xrm.Drain(ctx); err != nil {
+			// playbooks are not killed, interrupted jobs are reconciled on next start
+			// (server shutdown wait for all requests completion, so skipped)
+			log.Error().Err(err).Strs("operations", xrm.RunningOperations()).Msg("shutdown with running operations")
+			exitCode = 1
+		} else if err = app.Shutdown(); err != nil {
+			log.Error().Err(err).Msg("shutdown")
+		}
+	}
+
+	if err = tracing.Shutdown(context.Background()); err != nil {
+		log.Error().Err(err).Msg("tracing shutdown")
+	}
+	// pending deliveries are dropped (and logged) after shutdown deadline
+	if err = xrm.Cfg.Notifiers.Close(ctx); err != nil {
+		log.Error().Err(err).Msg("notifiers shutdown")
+	}
+	cancel()
+	if err = xrm.Cfg.Jobs.Close(); err != nil {
+		log.Error().Err(err).Msg("jobs history close")
+	}
+	if err = xrm.Cfg.Audit.Close(); err != nil {
+		log.Error().Err(err).Msg("audit log close")
 	}
+	log.Info().Msg("shutdown completed")
+	os.Exit(exitCode)
 }
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	xrm "github.com/xrm-tech/xrm-controller/app/xrm-controller"
+	"github.com/xrm-tech/xrm-controller/ovirt"
+	"github.com/xrm-tech/xrm-controller/pkg/jobs"
+	"github.com/xrm-tech/xrm-controller/pkg/mail"
+	"github.com/xrm-tech/xrm-controller/pkg/notify"
+	"github.com/xrm-tech/xrm-controller/pkg/tests"
+)
+
+func TestFailoverApproval(t *testing.T) {
+	var err error
+
+	if xrm.Cfg.Listen, err = tests.GetFreeLocalAddr(); err != nil {
+		t.Fatal(err)
+	}
+	if xrm.Cfg.OVirtStoreDir, err = os.MkdirTemp("", "xrm-controller"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(xrm.Cfg.OVirtStoreDir)
+
+	if err = os.MkdirAll(path.Join(xrm.Cfg.OVirtStoreDir, "test"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	request := "http://" + xrm.Cfg.Listen + "/ovirt/failover/test"
+
+	// create and start *fiber.App instance
+	xrm.Cfg.Logger = zerolog.New(os.Stdout)
+	xrm.Cfg.Users = map[string]string{"test1": "password1", "test2": "password2", "test3": "password3"}
+	xrm.Cfg.Roles, _ = xrm.ParseRoles([]string{"test1:operator", "test2:operator", "test3:viewer"})
+	xrm.Cfg.Approval = true
+	xrm.Cfg.ApprovalTimeout = time.Minute
+	defer func() {
+		xrm.Cfg.Roles = nil
+		xrm.Cfg.Approval = false
+	}()
+	app := xrm.RouterInit()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		wg.Done()
+		_ = app.Listen(xrm.Cfg.Listen)
+	}()
+	wg.Wait()
+	defer func() { _ = app.Shutdown() }()
+	time.Sleep(time.Millisecond * 10)
+
+	// viewer can't request failover
+	if _, err = tests.DoRequest("GET", request, "test3", "password3", http.StatusForbidden); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := tests.DoRequest("GET", request, "test1", "password1", http.StatusAccepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var approval xrm.Approval
+	if err = json.Unmarshal(body, &approval); err != nil {
+		t.Fatal(err)
+	}
+	if approval.Status != xrm.ApprovalPending || approval.RequestedBy != "test1" || approval.ID == "" {
+		t.Fatalf("approval = %+v", approval)
+	}
+
+	// only one pending request
+	if _, err = tests.DoRequest("GET", request, "test2", "password2", http.StatusConflict); err != nil {
+		t.Fatal(err)
+	}
+	// viewer can see pending request
+	if _, err = tests.DoRequest("GET", request+"/approval", "test3", "password3", http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+	// requester can't approve
+	if _, err = tests.DoRequest("GET", request+"/approve/"+approval.ID, "test1", "password1", http.StatusForbidden); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tests.DoRequest("GET", request+"/approve/invalid", "test2", "password2", http.StatusNotFound); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tests.DoRequest("GET", request+"/reject/"+approval.ID, "test2", "password2", http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tests.DoRequest("GET", request+"/approval", "test2", "password2", http.StatusNotFound); err != nil {
+		t.Fatal(err)
+	}
+
+	// per-request playbook settings are not allowed without limits
+	if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/ovirt/cleanup/test?verbosity=1", "test1", "password1", http.StatusBadRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	// failover not started, so no playbook result
+	if _, err = tests.DoRequest("GET", request+"/result", "test3", "password3", http.StatusNotFound); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/ovirt/delete/test/result", "test3", "password3", http.StatusBadRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path.Join(xrm.Cfg.OVirtStoreDir, "test", "approval.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trail := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(trail) != 2 || !strings.Contains(trail[0], `"status":"pending"`) || !strings.Contains(trail[1], `"status":"rejected"`) {
+		t.Fatalf("approval trail = %q", trail)
+	}
+}
+
+func TestFailoverExecutor(t *testing.T) {
+	var err error
+
+	if xrm.Cfg.Listen, err = tests.GetFreeLocalAddr(); err != nil {
+		t.Fatal(err)
+	}
+	if xrm.Cfg.OVirtStoreDir, err = os.MkdirTemp("", "xrm-controller"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(xrm.Cfg.OVirtStoreDir)
+
+	if err = os.MkdirAll(path.Join(xrm.Cfg.OVirtStoreDir, "test"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// playbook output is replayed, so ansible is not needed
+	fake := &ovirt.FakeExecutor{Outputs: map[string]ovirt.FakeOutput{
+		"failover": {
+			Out: "PLAY [oVirt Disaster Recovery] ****\nTASK [ovirt.ovirt.disaster_recovery : Start failover] ****\nchanged: [localhost]\n" +
+				"PLAY RECAP ****\nlocalhost                  : ok=1    changed=1    unreachable=0    failed=0\n",
+		},
+	}}
+	ovirt.SetExecutor(fake)
+	defer ovirt.SetExecutor(ovirt.LocalExecutor{})
+
+	if xrm.Cfg.Jobs, err = jobs.Open(path.Join(xrm.Cfg.OVirtStoreDir, "jobs.jsonl"), jobs.Retention{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = xrm.Cfg.Jobs.Close()
+		xrm.Cfg.Jobs = nil
+	}()
+
+	xrm.Cfg.Logger = zerolog.New(os.Stdout)
+	xrm.Cfg.Users = map[string]string{"test1": "password1"}
+	app := xrm.RouterInit()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		wg.Done()
+		_ = app.Listen(xrm.Cfg.Listen)
+	}()
+	wg.Wait()
+	defer func() { _ = app.Shutdown() }()
+	time.Sleep(time.Millisecond * 10)
+
+	request := "http://" + xrm.Cfg.Listen + "/ovirt/failover/test"
+	body, err := tests.DoRequest("GET", request, "test1", "password1", http.StatusOK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "changed: [localhost]") {
+		t.Errorf("failover response = %q", string(body))
+	}
+
+	body, err = tests.DoRequest("GET", request+"/result", "test1", "password1", http.StatusOK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result ovirt.PlaybookResult
+	if err = json.Unmarshal(body, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Result != "success" || len(result.Plays) != 1 || result.Plays[0].Tasks[0].Status != ovirt.TaskChanged {
+		t.Errorf("failover result = %+v", result)
+	}
+
+	// previous run log is moved to logs history
+	time.Sleep(time.Millisecond * 5)
+	if _, err = tests.DoRequest("GET", request, "test1", "password1", http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+	body, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/ovirt/logs/test?operation=failover", "test1", "password1", http.StatusOK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []ovirt.RunLog
+	if err = json.Unmarshal(body, &logs); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 || !logs[0].Current || logs[0].File != "failover.log" || logs[1].Result != "success" {
+		t.Errorf("failover logs = %+v", logs)
+	}
+	if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/ovirt/logs/test?operation=delete", "test1", "password1", http.StatusBadRequest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/ovirt/logs/test2", "test1", "password1", http.StatusNotFound); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/jobs?operation=failover&limit=1", "test1", "password1", http.StatusOK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page xrm.JobsPage
+	if err = json.Unmarshal(body, &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(page.Jobs) != 1 || page.Jobs[0].Status != jobs.StatusSuccess || page.Jobs[0].ExitCode != 0 ||
+		page.Jobs[0].Username != "test1" || !strings.Contains(page.Jobs[0].Log, "/test/logs/failover.") || len(page.Jobs[0].Result) == 0 {
+		t.Errorf("jobs = %+v", page)
+	}
+	// previous run job point to log in history
+	body, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/jobs?operation=failover&offset=1", "test1", "password1", http.StatusOK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(body, &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Jobs) != 1 || !strings.HasSuffix(page.Jobs[0].Log, "/test/"+logs[1].File) {
+		t.Errorf("previous run job log = %q, want %q", page.Jobs[0].Log, logs[1].File)
+	}
+	if _, err = os.Stat(page.Jobs[0].Log); err != nil {
+		t.Errorf("previous run job log %q not exist", page.Jobs[0].Log)
+	}
+	if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/jobs/"+page.Jobs[0].ID, "test1", "password1", http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/jobs/unknown", "test1", "password1", http.StatusNotFound); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/jobs?limit=0", "test1", "password1", http.StatusBadRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	if runs := fake.Runs(); len(runs) != 2 || runs[0].Name != "test" {
+		t.Errorf("executor runs = %+v", runs)
+	}
+}
+
+func TestOperationsQueue(t *testing.T) {
+	var err error
+
+	if xrm.Cfg.Listen, err = tests.GetFreeLocalAddr(); err != nil {
+		t.Fatal(err)
+	}
+	if xrm.Cfg.OVirtStoreDir, err = os.MkdirTemp("", "xrm-controller"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(xrm.Cfg.OVirtStoreDir)
+
+	if err = os.MkdirAll(path.Join(xrm.Cfg.OVirtStoreDir, "test"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	out := "PLAY RECAP ****\nlocalhost                  : ok=1    changed=1    unreachable=0    failed=0\n"
+	fake := &ovirt.FakeExecutor{Outputs: map[string]ovirt.FakeOutput{
+		"failover": {Out: out, Delay: time.Millisecond * 500},
+		"cleanup":  {Out: out},
+	}}
+	ovirt.SetExecutor(fake)
+	defer ovirt.SetExecutor(ovirt.LocalExecutor{})
+	ovirt.SetQueue(ovirt.QueueConfig{MaxDepth: 1})
+	defer ovirt.SetQueue(ovirt.QueueConfig{})
+
+	if xrm.Cfg.Jobs, err = jobs.Open(path.Join(xrm.Cfg.OVirtStoreDir, "jobs.jsonl"), jobs.Retention{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = xrm.Cfg.Jobs.Close()
+		xrm.Cfg.Jobs = nil
+	}()
+
+	xrm.Cfg.Logger = zerolog.New(os.Stdout)
+	xrm.Cfg.Users = map[string]string{"test1": "password1", "test2": "password2"}
+	xrm.Cfg.Roles = xrm.Roles{"test1": {{Role: xrm.RoleOperator}}, "test2": {{Role: xrm.RoleViewer}}}
+	defer func() { xrm.Cfg.Roles = nil }()
+	app := xrm.RouterInit()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		wg.Done()
+		_ = app.Listen(xrm.Cfg.Listen)
+	}()
+	wg.Wait()
+	defer func() { _ = app.Shutdown() }()
+	time.Sleep(time.Millisecond * 10)
+
+	base := "http://" + xrm.Cfg.Listen
+	queryJobs := func(query string) (page xrm.JobsPage) {
+		body, err := tests.DoRequest("GET", base+"/jobs?"+query, "test1", "password1", http.StatusOK)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal(body, &page); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	waitJobs := func(query string) (page xrm.JobsPage) {
+		for i := 0; i < 100; i++ {
+			if page = queryJobs(query); page.Total > 0 {
+				return
+			}
+			time.Sleep(time.Millisecond * 5)
+		}
+		t.Fatalf("jobs %s not found", query)
+		return
+	}
+
+	var requests sync.WaitGroup
+	requests.Add(2)
+	go func() {
+		defer requests.Done()
+		if _, err := tests.DoRequest("GET", base+"/ovirt/failover/test", "test1", "password1", http.StatusOK); err != nil {
+			t.Error(err)
+		}
+	}()
+	waitJobs("status=running")
+
+	go func() {
+		defer requests.Done()
+		if _, err := tests.DoRequest("GET", base+"/ovirt/cleanup/test", "test1", "password1", http.StatusInternalServerError); err != nil {
+			t.Error(err)
+		}
+	}()
+	page := waitJobs("status=queued")
+	if len(page.Jobs) != 1 || page.Jobs[0].Operation != "cleanup" || page.Jobs[0].QueuePosition != 1 || page.Jobs[0].Queued == nil {
+		t.Fatalf("queued jobs = %+v", page)
+	}
+	id := page.Jobs[0].ID
+
+	// queue is full
+	if _, err = tests.DoRequest("GET", base+"/ovirt/failback/test", "test1", "password1", http.StatusInternalServerError); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = tests.DoRequest("POST", base+"/jobs/"+id+"/cancel", "test2", "password2", http.StatusForbidden); err != nil {
+		t.Error(err)
+	}
+	if _, err = tests.DoRequest("POST", base+"/jobs/"+id+"/cancel", "test1", "password1", http.StatusOK); err != nil {
+		t.Error(err)
+	}
+	if _, err = tests.DoRequest("POST", base+"/jobs/"+id+"/cancel", "test1", "password1", http.StatusConflict); err != nil {
+		t.Error(err)
+	}
+	requests.Wait()
+
+	page = queryJobs("")
+	statuses := make(map[string]jobs.Status)
+	for _, j := range page.Jobs {
+		statuses[j.Operation] = j.Status
+	}
+	if page.Total != 2 || statuses["failover"] != jobs.StatusSuccess || statuses["cleanup"] != jobs.StatusCanceled {
+		t.Errorf("jobs = %+v", page)
+	}
+	if runs := fake.Runs(); len(runs) != 1 || runs[0].Operation != "failover" {
+		t.Errorf("executor runs = %+v", runs)
+	}
+}
+
+// eventsRecorder record notifications
+type eventsRecorder struct {
+	lock   sync.Mutex
+	events []notify.Event
+}
+
+func (r *eventsRecorder) Notify(e notify.Event) {
+	r.lock.Lock()
+	r.events = append(r.events, e)
+	r.lock.Unlock()
+}
+
+func (r *eventsRecorder) Close(context.Context) error {
+	return nil
+}
+
+func TestFailoverMailStoragesRemap(t *testing.T) {
+	var err error
+
+	if xrm.Cfg.Listen, err = tests.GetFreeLocalAddr(); err != nil {
+		t.Fatal(err)
+	}
+	if xrm.Cfg.OVirtStoreDir, err = os.MkdirTemp("", "xrm-controller"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(xrm.Cfg.OVirtStoreDir)
+
+	// config storages mapping, written by generate
+	if err = os.MkdirAll(path.Join(xrm.Cfg.OVirtStoreDir, "test"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile("../../ovirt/tests/disaster_recovery_vars.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path.Join(xrm.Cfg.OVirtStoreDir, "test", "disaster_recovery_vars.yml"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &ovirt.FakeExecutor{Outputs: map[string]ovirt.FakeOutput{
+		"failover": {Out: "PLAY [oVirt Disaster Recovery] ****\nPLAY RECAP ****\n"},
+		"failback": {Out: "PLAY [oVirt Disaster Recovery] ****\nPLAY RECAP ****\n"},
+	}}
+	ovirt.SetExecutor(fake)
+	defer ovirt.SetExecutor(ovirt.LocalExecutor{})
+
+	recorder := &eventsRecorder{}
+	xrm.Cfg.Notifiers = notify.Notifiers{recorder}
+	defer func() { xrm.Cfg.Notifiers = nil }()
+
+	xrm.Cfg.Logger = zerolog.New(os.Stdout)
+	xrm.Cfg.Users = map[string]string{"test1": "password1"}
+	app := xrm.RouterInit()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		wg.Done()
+		_ = app.Listen(xrm.Cfg.Listen)
+	}()
+	wg.Wait()
+	defer func() { _ = app.Shutdown() }()
+	time.Sleep(time.Millisecond * 10)
+
+	for _, operation := range []string{"failover", "failback"} {
+		if _, err = tests.DoRequest("GET", "http://"+xrm.Cfg.Listen+"/ovirt/"+operation+"/test", "test1", "password1", http.StatusOK); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mailer, err := mail.New(mail.Config{
+		Server: "127.0.0.1:25", TLS: mail.TLSNone, From: "xrm@localhost",
+		Recipients: []mail.Recipients{{To: []string{"dr@localhost"}}},
+	}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = mailer.Close(context.Background()) }()
+
+	wantRemap := map[string]string{
+		"failover.completed": "Storages remap:\n  storage nfs_dom remapped with name nfs_dom as nfs://10.1.2.2:/nfs_dom_dr2\n",
+		"failback.completed": "Storages remap:\n  storage nfs_dom remapped with name nfs_dom as nfs://10.1.1.2:/nfs_dom_dr\n",
+	}
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	for _, e := range recorder.events {
+		want, ok := wantRemap[e.Event]
+		if !ok {
+			continue
+		}
+		delete(wantRemap, e.Event)
+		msg, err := mailer.Render(&e, []string{"dr@localhost"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(msg), want) {
+			t.Errorf("%s mail = %q, want contain %q", e.Event, string(msg), want)
+		}
+	}
+	if len(wantRemap) > 0 {
+		t.Errorf("events not sent: %v", wantRemap)
+	}
+}
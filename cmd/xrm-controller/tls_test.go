@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	xrm "github.com/xrm-tech/xrm-controller/app/xrm-controller"
+	"github.com/xrm-tech/xrm-controller/pkg/tests"
+)
+
+func TestMutualTLS(t *testing.T) {
+	var err error
+
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, err := tests.GenerateCert(nil, "CA", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, err := tests.GenerateCert(ca, "localhost", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xrm.Cfg.TLSCert, xrm.Cfg.TLSKey, err = serverCert.WriteFiles(dir, "server"); err != nil {
+		t.Fatal(err)
+	}
+	if xrm.Cfg.TLSClientCA, _, err = ca.WriteFiles(dir, "ca"); err != nil {
+		t.Fatal(err)
+	}
+	xrm.Cfg.TLSClientCertOptional = true
+	xrm.Cfg.OVirtStoreDir = dir
+	xrm.Cfg.Logger = zerolog.New(os.Stdout)
+	xrm.Cfg.Users = map[string]string{"test1": "password1", "admin": "password"}
+	xrm.Cfg.Roles, _ = xrm.ParseRoles([]string{"test1:viewer", "admin:admin"})
+	defer func() {
+		xrm.Cfg.TLSCert = ""
+		xrm.Cfg.TLSKey = ""
+		xrm.Cfg.TLSClientCA = ""
+		xrm.Cfg.TLSClientCertOptional = false
+		xrm.Cfg.Roles = nil
+	}()
+
+	if enabled, err := xrm.TLSEnabled(); !enabled || err != nil {
+		t.Fatalf("TLSEnabled() = %v, %v", enabled, err)
+	}
+	tlsConfig, err := xrm.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := "https://" + ln.Addr().String() + "/ovirt/delete/test"
+
+	app := xrm.RouterInit()
+	go func() {
+		_ = app.Listener(tls.NewListener(ln, tlsConfig))
+	}()
+	defer func() { _ = app.Shutdown() }()
+	time.Sleep(time.Millisecond * 10)
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.Cert)
+
+	cases := []struct {
+		name       string
+		clientCN   string
+		username   string
+		password   string
+		wantStatus int
+	}{
+		{name: "viewer cert", clientCN: "test1", wantStatus: http.StatusForbidden},
+		{name: "admin cert", clientCN: "admin", wantStatus: http.StatusOK},
+		{name: "viewer basic auth", username: "test1", password: "password1", wantStatus: http.StatusForbidden},
+		{name: "admin basic auth", username: "admin", password: "password", wantStatus: http.StatusOK},
+		{name: "anonymous", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}
+			if tt.clientCN != "" {
+				clientCert, err := tests.GenerateCert(ca, tt.clientCN, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cert, err := tls.X509KeyPair(clientCert.Cert, clientCert.Key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+			}
+			client := http.Client{Transport: transport, Timeout: time.Second * 10}
+			req, _ := http.NewRequest("GET", request, nil)
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("%s = %d (%s), want %d", request, resp.StatusCode, string(body), tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package ovirt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/juju/fslock"
+
+	"github.com/xrm-tech/xrm-controller/pkg/secrets"
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+var (
+	ErrCredentialsEmpty = errors.New("credentials not set")
+	ErrEngineNotFound   = errors.New("configs with engine url not found")
+)
+
+// CredentialsVars is an engines passwords update for config (empty passwords are not changed)
+type CredentialsVars struct {
+	PrimaryPassword      string `json:"site_primary_password"`
+	PrimaryPasswordRef   string `json:"site_primary_password_ref,omitempty"`
+	SecondaryPassword    string `json:"site_secondary_password"`
+	SecondaryPasswordRef string `json:"site_secondary_password_ref,omitempty"`
+}
+
+func (v CredentialsVars) Validate() error {
+	var errs Errors
+
+	if v.PrimaryPassword == "" && v.PrimaryPasswordRef == "" && v.SecondaryPassword == "" && v.SecondaryPasswordRef == "" {
+		return Errors{ErrCredentialsEmpty.Error()}
+	}
+	if v.PrimaryPassword != "" || v.PrimaryPasswordRef != "" {
+		errs = validatePassword(errs, "site_primary_password", v.PrimaryPassword, v.PrimaryPasswordRef)
+	}
+	if v.SecondaryPassword != "" || v.SecondaryPasswordRef != "" {
+		errs = validatePassword(errs, "site_secondary_password", v.SecondaryPassword, v.SecondaryPasswordRef)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ResolveSecrets resolve password references to passwords
+func (v *CredentialsVars) ResolveSecrets(resolver secrets.Resolver) error {
+	var errs Errors
+
+	errs = resolvePassword(errs, resolver, "site_primary_password_ref", v.PrimaryPasswordRef, &v.PrimaryPassword)
+	errs = resolvePassword(errs, resolver, "site_secondary_password_ref", v.SecondaryPasswordRef, &v.SecondaryPassword)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// EngineCredentialsVars is an engine password update for all configs, which use engine url
+type EngineCredentialsVars struct {
+	Url         string `json:"engine_url"`
+	Password    string `json:"engine_password"`
+	PasswordRef string `json:"engine_password_ref,omitempty"`
+}
+
+func (v EngineCredentialsVars) Validate() error {
+	var errs Errors
+
+	errs = validateUrl(errs, "engine_url", v.Url)
+	errs = validatePassword(errs, "engine_password", v.Password, v.PasswordRef)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ResolveSecrets resolve password reference to password
+func (v *EngineCredentialsVars) ResolveSecrets(resolver secrets.Resolver) error {
+	if errs := resolvePassword(nil, resolver, "engine_password_ref", v.PasswordRef, &v.Password); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// sitesVars is an engines address/credentials, stored in config
+type sitesVars struct {
+	PrimaryUrl        string
+	PrimaryUsername   string
+	PrimaryPassword   string
+	SecondaryUrl      string
+	SecondaryUsername string
+	SecondaryPassword string
+}
+
+func readKVFile(file string, fn func(k, v string)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if k, v, ok := splitKV(scanner.Text(), false); ok {
+			fn(k, v)
+		}
+	}
+	return scanner.Err()
+}
+
+// readSitesVars read engines address/credentials from {dir}/disaster_recovery_vars.yml and {dir}/ovirt_passwords.yml
+func readSitesVars(dir string) (s sitesVars, err error) {
+	if err = readKVFile(path.Join(dir, ansibleDrVarsFile), func(k, v string) {
+		switch k {
+		case "dr_sites_primary_url":
+			s.PrimaryUrl = v
+		case "dr_sites_primary_username":
+			s.PrimaryUsername = v
+		case "dr_sites_secondary_url":
+			s.SecondaryUrl = v
+		case "dr_sites_secondary_username":
+			s.SecondaryUsername = v
+		}
+	}); err != nil {
+		return
+	}
+	err = readKVFile(path.Join(dir, ansibleDrPwdFile), func(k, v string) {
+		switch k {
+		case "dr_sites_primary_password":
+			s.PrimaryPassword = v
+		case "dr_sites_secondary_password":
+			s.SecondaryPassword = v
+		}
+	})
+	return
+}
+
+// writeAnsiblePwdFile write passwords file (over temporary file, so it's not corrupted on failure)
+func writeAnsiblePwdFile(pwdFile, primaryPassword, secondaryPassword string) error {
+	var buf bytes.Buffer
+	buf.Grow(128)
+	// TODO: encrypt with ansible vault
+	buf.WriteString("dr_sites_primary_password: ")
+	buf.WriteString(primaryPassword)
+	buf.WriteString("\ndr_sites_secondary_password: ")
+	buf.WriteString(secondaryPassword)
+
+	tmpFile := pwdFile + ".tmp"
+	if err := os.WriteFile(tmpFile, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, pwdFile)
+}
+
+func sameUrl(a, b string) bool {
+	return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+}
+
+// updateCredentials validate and write passwords for config in dir (empty passwords are not changed),
+// must be called under operations lock (config file lock is acquired by updateCredentials)
+func updateCredentials(dir, primaryPassword, secondaryPassword string) (err error) {
+	flock := fslock.New(dir + ".lock")
+	if err = flock.TryLock(); err != nil {
+		return
+	}
+	defer func() { _ = flock.Unlock() }()
+
+	var s sitesVars
+	if s, err = readSitesVars(dir); err != nil {
+		return
+	}
+
+	if primaryPassword != "" {
+		if err = validateOvirtCon(context.Background(), s.PrimaryUrl, false, path.Join(dir, "primary.ca"), s.PrimaryUsername, primaryPassword); err != nil {
+			return errors.New("primary site " + s.PrimaryUrl + ": " + err.Error())
+		}
+		s.PrimaryPassword = primaryPassword
+	}
+	if secondaryPassword != "" {
+		if err = validateOvirtCon(context.Background(), s.SecondaryUrl, false, path.Join(dir, "secondary.ca"), s.SecondaryUsername, secondaryPassword); err != nil {
+			return errors.New("secondary site " + s.SecondaryUrl + ": " + err.Error())
+		}
+		s.SecondaryPassword = secondaryPassword
+	}
+
+	return writeAnsiblePwdFile(path.Join(dir, ansibleDrPwdFile), s.PrimaryPassword, s.SecondaryPassword)
+}
+
+// UpdateCredentials update engines passwords for {dir}/{name}
+func (v CredentialsVars) UpdateCredentials(name, dir string) error {
+	if !ValidateName(name) {
+		return ErrNameInvalid
+	}
+
+	dir = path.Join(dir, name)
+	if !utils.DirExists(dir) {
+		return ErrDirNotExist
+	}
+
+	if !lock.TryLock() {
+		return ErrInProgress
+	}
+	defer lock.Unlock()
+
+	return updateCredentials(dir, v.PrimaryPassword, v.SecondaryPassword)
+}
+
+// UpdateCredentials update engine password for all configs in dir, which use engine url.
+// Return updated configs names (and errors for failed configs).
+func (v EngineCredentialsVars) UpdateCredentials(dir string) (updated []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	if !lock.TryLock() {
+		return nil, ErrInProgress
+	}
+	defer lock.Unlock()
+
+	var (
+		errs  Errors
+		found bool
+	)
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() || !ValidateName(name) {
+			continue
+		}
+		configDir := path.Join(dir, name)
+		s, rErr := readSitesVars(configDir)
+		if rErr != nil {
+			// not generated or broken config
+			continue
+		}
+		var primaryPassword, secondaryPassword string
+		if sameUrl(s.PrimaryUrl, v.Url) {
+			primaryPassword = v.Password
+		}
+		if sameUrl(s.SecondaryUrl, v.Url) {
+			secondaryPassword = v.Password
+		}
+		if primaryPassword == "" && secondaryPassword == "" {
+			continue
+		}
+		found = true
+		if uErr := updateCredentials(configDir, primaryPassword, secondaryPassword); uErr == nil {
+			updated = append(updated, name)
+		} else {
+			errs = append(errs, name+": "+uErr.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		err = errs
+	} else if !found {
+		err = ErrEngineNotFound
+	}
+
+	return
+}
@@ -0,0 +1,75 @@
+package ovirt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestEngineCredentialsVars_UpdateCredentials(t *testing.T) {
+	_, filename, _, _ := runtime.Caller(0)
+	testDir := path.Join(path.Dir(filename), "tests")
+
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// secondary engine is on closed local port, so engine validation fail without DNS and network
+	srv := httptest.NewServer(http.NotFoundHandler())
+	secondaryUrl := "https://" + srv.Listener.Addr().String() + "/ovirt-engine/api"
+	srv.Close()
+	vars, err := os.ReadFile(path.Join(testDir, ansibleDrVarsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars = []byte(strings.Replace(string(vars), "https://saengine2.localdomain/ovirt-engine/api", secondaryUrl, 1))
+	configDir := path.Join(dir, "test")
+	if err = os.Mkdir(configDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path.Join(configDir, ansibleDrVarsFile), vars, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err = writeAnsiblePwdFile(path.Join(configDir, ansibleDrPwdFile), "pwd1", "pwd:2"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readSitesVars(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sitesVars{
+		PrimaryUrl:        "https://saengine.localdomain/ovirt-engine/api",
+		PrimaryUsername:   "admin@internal",
+		PrimaryPassword:   "pwd1",
+		SecondaryUrl:      secondaryUrl,
+		SecondaryUsername: "admin@internal",
+		SecondaryPassword: "pwd:2",
+	}
+	if got != want {
+		t.Fatalf("readSitesVars() = %+v, want %+v", got, want)
+	}
+
+	v := EngineCredentialsVars{Url: "https://saengine3.localdomain/ovirt-engine/api", Password: "pwd3"}
+	if updated, err := v.UpdateCredentials(dir); err != ErrEngineNotFound || len(updated) != 0 {
+		t.Fatalf("EngineCredentialsVars.UpdateCredentials() = %v, %v", updated, err)
+	}
+
+	// engine is unavailable, so validation must fail and passwords must not be changed
+	v.Url = secondaryUrl + "/"
+	if updated, err := v.UpdateCredentials(dir); err == nil || len(updated) != 0 {
+		t.Fatalf("EngineCredentialsVars.UpdateCredentials() = %v, %v", updated, err)
+	}
+	if got, err = readSitesVars(configDir); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("readSitesVars() after failed update = %+v, want %+v", got, want)
+	}
+}
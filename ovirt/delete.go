@@ -5,12 +5,13 @@ import (
 	"path"
 
 	"github.com/juju/fslock"
+	"github.com/xrm-tech/xrm-controller/pkg/metrics"
 	"github.com/xrm-tech/xrm-controller/pkg/utils"
 )
 
 // Delete delete {dir}/{name}
 func Delete(name, dir string) (err error) {
-	if !validateName(name) {
+	if !ValidateName(name) {
 		return ErrNameInvalid
 	}
 
@@ -28,7 +29,9 @@ func Delete(name, dir string) (err error) {
 		}
 		defer func() { _ = flock.Unlock() }()
 
-		err = os.RemoveAll(dir)
+		if err = os.RemoveAll(dir); err == nil {
+			metrics.Deleted(name)
+		}
 	}
 	return
 }
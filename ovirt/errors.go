@@ -3,6 +3,8 @@ package ovirt
 import (
 	"errors"
 	"strings"
+
+	"github.com/juju/fslock"
 )
 
 var (
@@ -10,6 +12,10 @@ var (
 	ErrDirNotExist     = errors.New("dir not exist, run generate")
 	ErrInProgress      = errors.New("another operation in progress")
 	ErrAnsibleNotFound = errors.New("ansible-playbook not found")
+
+	ErrCaInvalid            = errors.New("CA certificate is invalid")
+	ErrCaFingerprintInvalid = errors.New("CA certificate fingerprint is invalid")
+	ErrCaExtraData          = errors.New("CA certificate contain extra data (only one certificate is allowed)")
 )
 
 type Errors []string
@@ -22,3 +28,15 @@ func (errs Errors) Error() string {
 	}
 	return buf.String()
 }
+
+// outcome return operation outcome for metrics (busy if rejected or canceled in queue, because another operation in progress)
+func outcome(err error) string {
+	switch err {
+	case nil:
+		return "success"
+	case ErrInProgress, ErrQueueFull, ErrQueueCanceled, fslock.ErrLocked:
+		return "busy"
+	default:
+		return "failed"
+	}
+}
@@ -0,0 +1,188 @@
+package ovirt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+var (
+	ErrAnsibleRunnerNotFound = errors.New("ansible-runner not found")
+	ErrExecutorInvalid       = errors.New("executor is invalid, must be local, ansible-runner or container")
+
+	executor Executor = LocalExecutor{}
+)
+
+// Playbook is a playbook run request
+type Playbook struct {
+	Operation string
+	Name      string
+	// Dir is a config dir
+	Dir      string
+	Playbook string
+	Tags     []string
+	// Vars is an extra vars, passed by controller (can contain secrets)
+	Vars     map[string]string
+	Settings PlaybookSettings
+	LogFile  string
+	// OnStart (if not nil) is called with playbook process id after start
+	OnStart func(pid int)
+	// OnLine (if not nil) is called for each output line while playbook is running
+	OnLine func(line string)
+}
+
+// ExtraVars return extra vars (settings and controller vars) as JSON, empty if no vars
+func (p *Playbook) ExtraVars() string {
+	if len(p.Vars) == 0 && len(p.Settings.ExtraVars) == 0 {
+		return ""
+	}
+	vars := make(map[string]string, len(p.Vars)+len(p.Settings.ExtraVars))
+	for k, v := range p.Settings.ExtraVars {
+		vars[k] = v
+	}
+	for k, v := range p.Vars {
+		vars[k] = v
+	}
+	b, _ := json.Marshal(vars)
+	return string(b)
+}
+
+// Executor run playbooks
+type Executor interface {
+	// Check check executor is available
+	Check() error
+	// Run run playbook, output is written to p.LogFile
+	Run(ctx context.Context, p *Playbook) (string, error)
+}
+
+// SetExecutor set executor for playbook runs (LocalExecutor by default)
+func SetExecutor(e Executor) {
+	executor = e
+}
+
+// ExecutorConfig is an executor config
+type ExecutorConfig struct {
+	// Name is local, ansible-runner or container
+	Name      string
+	Container ContainerExecutor
+}
+
+// NewExecutor return executor by config
+func NewExecutor(cfg ExecutorConfig) (Executor, error) {
+	switch cfg.Name {
+	case "", "local":
+		return LocalExecutor{}, nil
+	case "ansible-runner":
+		return RunnerExecutor{}, nil
+	case "container":
+		return cfg.Container, nil
+	default:
+		return nil, ErrExecutorInvalid
+	}
+}
+
+// LocalExecutor run ansible-playbook on local host
+type LocalExecutor struct {
+	// Command is ansible-playbook command (ansible-playbook from PATH if empty)
+	Command string
+}
+
+func (e LocalExecutor) command() string {
+	if e.Command == "" {
+		return "ansible-playbook"
+	}
+	return e.Command
+}
+
+func (e LocalExecutor) Check() error {
+	if _, err := exec.LookPath(e.command()); err != nil {
+		return ErrAnsibleNotFound
+	}
+	return nil
+}
+
+func (e LocalExecutor) Run(ctx context.Context, p *Playbook) (string, error) {
+	command, err := exec.LookPath(e.command())
+	if err != nil {
+		return "", ErrAnsibleNotFound
+	}
+	args := []string{p.Playbook}
+	if len(p.Tags) > 0 {
+		args = append(args, "-t", strings.Join(p.Tags, ","))
+	}
+	if vars := p.ExtraVars(); vars != "" {
+		args = append(args, "-e", vars)
+	}
+	args = append(args, p.Settings.Args()...)
+
+	cmd := utils.Cmd{
+		Command: command, Args: args, Env: p.Settings.Environ(), OutFile: p.LogFile, Timeout: p.Settings.timeout(), OnStart: p.OnStart, OnLine: p.OnLine,
+	}
+	return cmd.Run(ctx)
+}
+
+// RunnerExecutor run playbook with ansible-runner, private data dir is {config_dir}/runner
+type RunnerExecutor struct {
+	// Command is ansible-runner command (ansible-runner from PATH if empty)
+	Command string
+	// RotateArtifacts is a kept artifacts dirs count (5 if 0)
+	RotateArtifacts int
+}
+
+func (e RunnerExecutor) command() string {
+	if e.Command == "" {
+		return "ansible-runner"
+	}
+	return e.Command
+}
+
+func (e RunnerExecutor) Check() error {
+	if _, err := exec.LookPath(e.command()); err != nil {
+		return ErrAnsibleRunnerNotFound
+	}
+	return nil
+}
+
+func (e RunnerExecutor) Run(ctx context.Context, p *Playbook) (string, error) {
+	command, err := exec.LookPath(e.command())
+	if err != nil {
+		return "", ErrAnsibleRunnerNotFound
+	}
+
+	dataDir := path.Join(p.Dir, "runner")
+	if err = os.MkdirAll(path.Join(dataDir, "env"), 0750); err != nil {
+		return "", err
+	}
+	// extra vars are passed with file (not visible in process list), removed after run
+	if vars := p.ExtraVars(); vars != "" {
+		varsFile := path.Join(dataDir, "env", "extravars")
+		if err = os.WriteFile(varsFile, []byte(vars), 0600); err != nil {
+			return "", err
+		}
+		defer os.Remove(varsFile)
+	}
+
+	rotate := e.RotateArtifacts
+	if rotate <= 0 {
+		rotate = 5
+	}
+	args := []string{"run", dataDir, "-p", p.Playbook, "--ident", p.Operation, "--rotate-artifacts", strconv.Itoa(rotate)}
+	// ansible-runner verbosity and forks flags are the same as for ansible-playbook
+	args = append(args, p.Settings.Args()...)
+	if len(p.Tags) > 0 {
+		args = append(args, "--cmdline", "--tags "+strings.Join(p.Tags, ","))
+	}
+
+	cmd := utils.Cmd{
+		Command: command, Args: args, Env: p.Settings.Environ(), OutFile: p.LogFile, Timeout: p.Settings.timeout(), OnStart: p.OnStart, OnLine: p.OnLine,
+	}
+	return cmd.Run(ctx)
+}
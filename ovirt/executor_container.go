@@ -0,0 +1,111 @@
+package ovirt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+var (
+	ErrContainerRuntimeNotFound = errors.New("container runtime not found")
+	ErrContainerImageEmpty      = errors.New("container image is empty")
+
+	// containerRemoveTimeout is a timeout for remove container after failed or interrupted run
+	containerRemoveTimeout = time.Second * 30
+)
+
+// ContainerExecutor run ansible-playbook inside OCI image with container runtime CLI (podman or docker),
+// config dir is bind-mounted with the same path (so paths in playbooks and vars are not changed)
+type ContainerExecutor struct {
+	// Runtime is a container runtime command (podman if empty)
+	Runtime string
+	// Image is a default image, can be overridden per config with playbook settings
+	Image string
+	// Network is a container network (host if empty)
+	Network string
+	// Args is an extra runtime run arguments (like --userns=keep-id)
+	Args []string
+}
+
+func (e ContainerExecutor) runtime() string {
+	if e.Runtime == "" {
+		return "podman"
+	}
+	return e.Runtime
+}
+
+func (e ContainerExecutor) Check() error {
+	if _, err := exec.LookPath(e.runtime()); err != nil {
+		return ErrContainerRuntimeNotFound
+	}
+	return nil
+}
+
+// runArgs return container runtime arguments for playbook run
+func (e ContainerExecutor) runArgs(p *Playbook, container, image string) []string {
+	network := e.Network
+	if network == "" {
+		network = "host"
+	}
+	args := []string{
+		"run", "--rm", "--init", "--name", container, "--network", network,
+		"-v", p.Dir + ":" + p.Dir + ":z", "-w", p.Dir,
+	}
+	// host environment is not passed to container, only settings env
+	keys := make([]string, 0, len(p.Settings.Env))
+	for k := range p.Settings.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-e", k+"="+p.Settings.Env[k])
+	}
+	args = append(args, e.Args...)
+
+	args = append(args, image, "ansible-playbook", p.Playbook)
+	if len(p.Tags) > 0 {
+		args = append(args, "-t", strings.Join(p.Tags, ","))
+	}
+	if vars := p.ExtraVars(); vars != "" {
+		args = append(args, "-e", vars)
+	}
+	return append(args, p.Settings.Args()...)
+}
+
+func (e ContainerExecutor) Run(ctx context.Context, p *Playbook) (string, error) {
+	runtime, err := exec.LookPath(e.runtime())
+	if err != nil {
+		return "", ErrContainerRuntimeNotFound
+	}
+	image := p.Settings.Image
+	if image == "" {
+		image = e.Image
+	}
+	if image == "" {
+		return "", ErrContainerImageEmpty
+	}
+
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	container := "xrm-" + p.Operation + "-" + p.Name + "-" + hex.EncodeToString(b[:])
+
+	cmd := utils.Cmd{
+		Command: runtime, Args: e.runArgs(p, container, image), OutFile: p.LogFile, Timeout: p.Settings.timeout(), OnStart: p.OnStart, OnLine: p.OnLine,
+	}
+	out, err := cmd.Run(ctx)
+	if err != nil {
+		// container can be alive after runtime CLI is killed (on timeout or cancel)
+		rmCtx, cancel := context.WithTimeout(context.Background(), containerRemoveTimeout)
+		_ = exec.CommandContext(rmCtx, runtime, "rm", "-f", container).Run()
+		cancel()
+	}
+
+	return out, err
+}
@@ -0,0 +1,85 @@
+package ovirt
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestContainerExecutor_Run(t *testing.T) {
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// container runtime stand-in, record calls and fail run if playbook is failed.yml
+	runtime := path.Join(dir, "runtime")
+	calls := path.Join(dir, "calls")
+	if err = os.WriteFile(runtime, []byte("#!/bin/sh\necho \"$@\" >> "+calls+"\n"+
+		"case \"$*\" in *failed.yml*) exit 2;; esac\necho 'PLAY [oVirt Disaster Recovery] ****'\n"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	e := ContainerExecutor{Runtime: runtime, Image: "xrm-ansible:2.11", Args: []string{"--userns=keep-id"}}
+	if err = e.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := Playbook{
+		Operation: "failover",
+		Name:      "test",
+		Dir:       dir,
+		Playbook:  path.Join(dir, "dr_failover.yml"),
+		Tags:      []string{drFailoverTag},
+		Settings:  PlaybookSettings{Image: "xrm-ansible:2.14", Env: map[string]string{"ANSIBLE_CONFIG": dir + "/ansible.cfg"}},
+		LogFile:   path.Join(dir, "failover.log"),
+	}
+	out, err := e.Run(context.Background(), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "PLAY [oVirt Disaster Recovery] ****\n" {
+		t.Errorf("ContainerExecutor.Run() = %q", out)
+	}
+
+	p.Playbook = path.Join(dir, "failed.yml")
+	p.Settings.Image = ""
+	if _, err = e.Run(context.Background(), &p); err == nil {
+		t.Fatal("ContainerExecutor.Run() must fail")
+	}
+
+	b, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("runtime calls = %q", lines)
+	}
+	fields := strings.Fields(lines[0])
+	container := fields[4]
+	if !strings.HasPrefix(container, "xrm-failover-test-") {
+		t.Errorf("container name = %q", container)
+	}
+	want := "run --rm --init --name " + container + " --network host -v " + dir + ":" + dir + ":z -w " + dir +
+		" -e ANSIBLE_CONFIG=" + dir + "/ansible.cfg --userns=keep-id xrm-ansible:2.14 ansible-playbook " + dir + "/dr_failover.yml -t fail_over -vvvvv"
+	if lines[0] != want {
+		t.Errorf("runtime run =\n%q\nwant\n%q", lines[0], want)
+	}
+	// per config image is not set, so default image is used
+	if !strings.Contains(lines[1], " xrm-ansible:2.11 ansible-playbook "+dir+"/failed.yml ") {
+		t.Errorf("runtime run = %q", lines[1])
+	}
+	// failed container is removed
+	if !strings.HasPrefix(lines[2], "rm -f xrm-failover-test-") {
+		t.Errorf("runtime rm = %q", lines[2])
+	}
+
+	e.Image = ""
+	if _, err = e.Run(context.Background(), &p); err != ErrContainerImageEmpty {
+		t.Errorf("ContainerExecutor.Run() = %v, want %v", err, ErrContainerImageEmpty)
+	}
+}
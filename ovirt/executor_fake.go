@@ -0,0 +1,113 @@
+package ovirt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+var ErrFakeOutputNotFound = errors.New("fake executor output not found")
+
+// FakeOutput is a recorded playbook run
+type FakeOutput struct {
+	Out string
+	Err error
+	// Files is a files (relative to config dir), created by playbook
+	Files map[string]string
+	// Delay is a run duration (interrupted by context)
+	Delay time.Duration
+}
+
+// LoadFakeOutput load recorded playbook output from playbook log (first line with command is skipped, timestamps and stderr prefixes are stripped)
+func LoadFakeOutput(file string) (FakeOutput, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return FakeOutput{}, err
+	}
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(lines) < 2 {
+		return FakeOutput{}, nil
+	}
+	var buf strings.Builder
+	for _, line := range lines[1:] {
+		if ts, s, ok := strings.Cut(line, " "); ok {
+			if _, err := time.Parse(utils.LogTimeFormat, ts); err == nil {
+				line = strings.TrimPrefix(s, utils.StderrPrefix)
+			}
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return FakeOutput{Out: buf.String()}, nil
+}
+
+// FakeExecutor replay recorded outputs (for tests), run requests are recorded
+type FakeExecutor struct {
+	lock sync.Mutex
+	// Outputs is a recorded outputs by operation/name or operation
+	Outputs map[string]FakeOutput
+	runs    []Playbook
+}
+
+func (e *FakeExecutor) Check() error {
+	return nil
+}
+
+func (e *FakeExecutor) Run(ctx context.Context, p *Playbook) (string, error) {
+	e.lock.Lock()
+	e.runs = append(e.runs, *p)
+	o, ok := e.Outputs[p.Operation+"/"+p.Name]
+	if !ok {
+		o, ok = e.Outputs[p.Operation]
+	}
+	e.lock.Unlock()
+	if !ok {
+		return "", ErrFakeOutputNotFound
+	}
+
+	if o.Delay > 0 {
+		ctx, cancel := context.WithTimeout(ctx, p.Settings.timeout())
+		defer cancel()
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(o.Delay):
+		}
+	}
+
+	for name, content := range o.Files {
+		if err := os.WriteFile(path.Join(p.Dir, name), []byte(content), 0640); err != nil {
+			return "", err
+		}
+	}
+
+	f, err := os.OpenFile(p.LogFile, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, _ = f.WriteString("fake " + p.Playbook + "\n")
+	for _, line := range strings.Split(strings.TrimRight(o.Out, "\n"), "\n") {
+		_, _ = f.WriteString(time.Now().Format(utils.LogTimeFormat) + " " + line + "\n")
+		if p.OnLine != nil {
+			p.OnLine(line)
+		}
+	}
+
+	return o.Out, o.Err
+}
+
+// Runs return recorded run requests
+func (e *FakeExecutor) Runs() []Playbook {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	runs := make([]Playbook, len(e.runs))
+	copy(runs, e.runs)
+	return runs
+}
@@ -0,0 +1,135 @@
+package ovirt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLocalExecutor_Run(t *testing.T) {
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	v1 := 1
+	e := LocalExecutor{Command: "echo"}
+	var lines []string
+	out, err := e.Run(context.Background(), &Playbook{
+		Operation: "generate",
+		Name:      "test",
+		Dir:       dir,
+		Playbook:  "dr_generate.yml",
+		Tags:      []string{"generate_mapping"},
+		Vars:      map[string]string{"site": "https://engine1"},
+		Settings:  PlaybookSettings{Verbosity: &v1, Forks: 2, ExtraVars: map[string]string{"dr_report_file": "/tmp/report 1"}},
+		LogFile:   path.Join(dir, "generate.log"),
+		OnLine:    func(line string) { lines = append(lines, line) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `dr_generate.yml -t generate_mapping -e {"dr_report_file":"/tmp/report 1","site":"https://engine1"} -v --forks 2` + "\n"
+	if out != want {
+		t.Errorf("LocalExecutor.Run() = %q, want %q", out, want)
+	}
+	if len(lines) != 1 || lines[0]+"\n" != want {
+		t.Errorf("LocalExecutor.Run() lines = %q", lines)
+	}
+}
+
+func TestFakeExecutor(t *testing.T) {
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Mkdir(path.Join(dir, "test"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &FakeExecutor{Outputs: map[string]FakeOutput{
+		"failover": {
+			Out: "PLAY [Failover] ****\nTASK [Start failover] ****\nok: [localhost]\n" +
+				"PLAY RECAP ****\nlocalhost                  : ok=1    changed=0    unreachable=0    failed=0\n",
+		},
+		"failback/test": {
+			Out: "PLAY [Failback] ****\nTASK [Start failback] ****\nfatal: [localhost]: FAILED! => {\"msg\": \"engine unavailable\"}\n",
+			Err: errors.New("exit status 2"),
+		},
+	}}
+	prev := executor
+	SetExecutor(fake)
+	defer SetExecutor(prev)
+
+	var result PlaybookResult
+	out, err := FailoverContext(WithResult(context.Background(), &result), "test", dir)
+	if err != nil {
+		t.Fatalf("FailoverContext() = %v", err)
+	}
+	if !strings.HasPrefix(out, "PLAY [Failover]") {
+		t.Errorf("FailoverContext() out = %q", out)
+	}
+	if result.Result != "success" || len(result.Plays) != 1 || result.Recap["localhost"].Ok != 1 {
+		t.Errorf("FailoverContext() result = %+v", result)
+	}
+	if stored, err := ReadResult("test", dir, "failover"); err != nil || stored.Result != "success" {
+		t.Errorf("ReadResult() = %+v, %v", stored, err)
+	}
+
+	if _, err = FailbackContext(WithResult(context.Background(), &result), "test", dir); err == nil || err.Error() != "exit status 2" {
+		t.Fatalf("FailbackContext() = %v", err)
+	}
+	wantFailed := []FailedTask{{Play: "Failback", Task: "Start failback", Host: "localhost", Status: TaskFailed, Msg: "engine unavailable"}}
+	if result.Result != "failed" || !reflect.DeepEqual(result.Failed, wantFailed) {
+		t.Errorf("FailbackContext() result = %+v", result)
+	}
+
+	if _, err = CleanupContext(context.Background(), "test", dir); err != ErrFakeOutputNotFound {
+		t.Fatalf("CleanupContext() = %v, want %v", err, ErrFakeOutputNotFound)
+	}
+
+	runs := fake.Runs()
+	if len(runs) != 3 {
+		t.Fatalf("FakeExecutor.Runs() = %d, want 3", len(runs))
+	}
+	if runs[0].Operation != "failover" || !reflect.DeepEqual(runs[0].Tags, []string{drFailoverTag}) || runs[0].Playbook != path.Join(dir, "test", ansibleFailoverPlaybook) {
+		t.Errorf("FakeExecutor.Runs()[0] = %+v", runs[0])
+	}
+
+	recorded, err := LoadFakeOutput(path.Join(dir, "test", "failover.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.Out != fake.Outputs["failover"].Out {
+		t.Errorf("LoadFakeOutput() = %q", recorded.Out)
+	}
+}
+
+func TestRunPlaybook_ResultWriteFailed(t *testing.T) {
+	dir := t.TempDir()
+	// result file can't be written
+	if err := os.MkdirAll(path.Join(dir, "test", "failover.result.json"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &FakeExecutor{Outputs: map[string]FakeOutput{
+		"failover": {Out: "PLAY [Failover] ****\nTASK [Start failover] ****\nok: [localhost]\n"},
+	}}
+	prev := executor
+	SetExecutor(fake)
+	defer SetExecutor(prev)
+
+	var result PlaybookResult
+	if _, err := FailoverContext(WithResult(context.Background(), &result), "test", dir); err != nil {
+		t.Fatalf("FailoverContext() = %v, playbook outcome must be kept", err)
+	}
+	if result.Result != "success" {
+		t.Errorf("FailoverContext() result = %+v", result)
+	}
+}
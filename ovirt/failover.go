@@ -1,12 +1,13 @@
 package ovirt
 
 import (
-	"os/exec"
+	"context"
 	"path"
-	"sync"
 	"time"
 
 	"github.com/juju/fslock"
+	"github.com/xrm-tech/xrm-controller/pkg/metrics"
+	"github.com/xrm-tech/xrm-controller/pkg/tracing"
 	"github.com/xrm-tech/xrm-controller/pkg/utils"
 )
 
@@ -14,20 +15,48 @@ var (
 	drCleanTag    = "clean_engine"
 	drFailoverTag = "fail_over"
 	drFailbackTag = "fail_back"
-
-	lock sync.Mutex
-	wg   sync.WaitGroup
 )
 
+// lockConfig acquire operations lock (operation is queued, if queue is enabled) and config lock.
+// Config dir must exist (or not exist, for generate), it's checked under lock, because config
+// can be generated or deleted while operation is queued
+func lockConfig(ctx context.Context, operation, name, dir string, mustExist bool) (unlock func(), err error) {
+	if err = lock.acquire(ctx, operation, name); err != nil {
+		return
+	}
+	flock := fslock.New(dir + ".lock")
+	if err = flock.TryLock(); err != nil {
+		lock.Unlock()
+		return
+	}
+	unlock = func() {
+		// config lock must be released before operations lock is passed to queued operation
+		_ = flock.Unlock()
+		lock.Unlock()
+	}
+
+	if exist := utils.DirExists(dir); exist != mustExist {
+		unlock()
+		if mustExist {
+			return nil, ErrDirNotExist
+		}
+		return nil, ErrDirAlreadyExist
+	}
+	return unlock, nil
+}
+
 // Failover initiate failover for {dir}/{name}
 func Failover(name, dir string) (out string, err error) {
-	ansiblePath, err := exec.LookPath("ansible-playbook")
-	if err != nil {
-		err = ErrAnsibleNotFound
+	return FailoverContext(context.Background(), name, dir)
+}
+
+// FailoverContext initiate failover for {dir}/{name}
+func FailoverContext(ctx context.Context, name, dir string) (out string, err error) {
+	if err = executor.Check(); err != nil {
 		return
 	}
 
-	if !validateName(name) {
+	if !ValidateName(name) {
 		return "", ErrNameInvalid
 	}
 
@@ -36,38 +65,42 @@ func Failover(name, dir string) (out string, err error) {
 		return "", ErrDirNotExist
 	}
 
-	if !lock.TryLock() {
-		return "", ErrInProgress
-	}
+	start := time.Now()
+	ctx, span := startOperation(ctx, "failover", name)
+	defer func() {
+		metrics.ObserveOperation("failover", name, outcome(err), start)
+		tracing.End(span, err)
+	}()
 
-	flock := fslock.New(dir + ".lock")
-	if err = flock.TryLock(); err != nil {
-		lock.Unlock()
+	unlock, err := lockConfig(ctx, "failover", name, dir, true)
+	if err != nil {
 		return
 	}
 
 	playbook := path.Join(dir, ansibleFailoverPlaybook)
 
-	wg.Add(1)
-
-	go func() {
-		defer func() {
-			lock.Unlock()
-			_ = flock.Unlock()
-			wg.Done()
-		}()
-		// TODO: reduce verbose ?
-		out, err = utils.ExecCmd(dir+"/failover.log", time.Minute*10, ansiblePath, playbook, "-t", drFailoverTag, "-vvvvv")
+	done := metrics.Started("failover")
+	started(ctx)
+	defer func() {
+		done()
+		unlock()
 	}()
 
-	wg.Wait()
-
-	return out, err
+	return runPlaybook(ctx, "failover", name, dir, playbook, []string{drFailoverTag}, nil)
 }
 
 // Failback initiate failback for {dir}/{name}
 func Failback(name, dir string) (out string, err error) {
-	if !validateName(name) {
+	return FailbackContext(context.Background(), name, dir)
+}
+
+// FailbackContext initiate failback for {dir}/{name}
+func FailbackContext(ctx context.Context, name, dir string) (out string, err error) {
+	if err = executor.Check(); err != nil {
+		return
+	}
+
+	if !ValidateName(name) {
 		return "", ErrNameInvalid
 	}
 
@@ -76,38 +109,42 @@ func Failback(name, dir string) (out string, err error) {
 		return "", ErrDirNotExist
 	}
 
-	if !lock.TryLock() {
-		return "", ErrInProgress
-	}
+	start := time.Now()
+	ctx, span := startOperation(ctx, "failback", name)
+	defer func() {
+		metrics.ObserveOperation("failback", name, outcome(err), start)
+		tracing.End(span, err)
+	}()
 
-	flock := fslock.New(dir + ".lock")
-	if err = flock.TryLock(); err != nil {
-		lock.Unlock()
+	unlock, err := lockConfig(ctx, "failback", name, dir, true)
+	if err != nil {
 		return
 	}
 
 	playbook := path.Join(dir, ansibleFailbackPlaybook)
 
-	wg.Add(1)
-
-	go func() {
-		defer func() {
-			lock.Unlock()
-			_ = flock.Unlock()
-			wg.Done()
-		}()
-		// TODO: reduce verbose ?
-		out, err = utils.ExecCmd(dir+"/failback.log", time.Minute*10, "ansible-playbook", playbook, "-t", drFailbackTag, "-vvvvv")
+	done := metrics.Started("failback")
+	started(ctx)
+	defer func() {
+		done()
+		unlock()
 	}()
 
-	wg.Wait()
-
-	return out, err
+	return runPlaybook(ctx, "failback", name, dir, playbook, []string{drFailbackTag}, nil)
 }
 
 // Cleanup cleanup for {dir}/{name}
 func Cleanup(name, dir string) (out string, err error) {
-	if !validateName(name) {
+	return CleanupContext(context.Background(), name, dir)
+}
+
+// CleanupContext cleanup for {dir}/{name}
+func CleanupContext(ctx context.Context, name, dir string) (out string, err error) {
+	if err = executor.Check(); err != nil {
+		return
+	}
+
+	if !ValidateName(name) {
 		return "", ErrNameInvalid
 	}
 
@@ -116,31 +153,26 @@ func Cleanup(name, dir string) (out string, err error) {
 		return "", ErrDirNotExist
 	}
 
-	if !lock.TryLock() {
-		return "", ErrInProgress
-	}
+	start := time.Now()
+	ctx, span := startOperation(ctx, "cleanup", name)
+	defer func() {
+		metrics.ObserveOperation("cleanup", name, outcome(err), start)
+		tracing.End(span, err)
+	}()
 
-	flock := fslock.New(dir + ".lock")
-	if err = flock.TryLock(); err != nil {
-		lock.Unlock()
+	unlock, err := lockConfig(ctx, "cleanup", name, dir, true)
+	if err != nil {
 		return
 	}
 
 	playbook := path.Join(dir, ansibleFailoverPlaybook)
 
-	wg.Add(1)
-
-	go func() {
-		defer func() {
-			lock.Unlock()
-			_ = flock.Unlock()
-			wg.Done()
-		}()
-		// TODO: reduce verbose ?
-		out, err = utils.ExecCmd(dir+"/cleanup.log", time.Minute*10, "ansible-playbook", playbook, "-t", drCleanTag, "-vvvvv")
+	done := metrics.Started("cleanup")
+	started(ctx)
+	defer func() {
+		done()
+		unlock()
 	}()
 
-	wg.Wait()
-
-	return out, err
+	return runPlaybook(ctx, "cleanup", name, dir, playbook, []string{drCleanTag}, nil)
 }
@@ -2,10 +2,9 @@ package ovirt
 
 import (
 	"bufio"
-	"bytes"
+	"context"
 	"errors"
 	"os"
-	"os/exec"
 	"path"
 	"regexp"
 	"strconv"
@@ -13,10 +12,14 @@ import (
 	"time"
 	"unicode/utf8"
 
-	"github.com/juju/fslock"
 	cp "github.com/otiai10/copy"
 	ovirtsdk4 "github.com/ovirt/go-ovirt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/xrm-tech/xrm-controller/pkg/metrics"
+	"github.com/xrm-tech/xrm-controller/pkg/secrets"
+	"github.com/xrm-tech/xrm-controller/pkg/tracing"
 	"github.com/xrm-tech/xrm-controller/pkg/utils"
 )
 
@@ -35,7 +38,10 @@ var (
 	ansibleDrPwdFile        = "ovirt_passwords.yml"
 )
 
-func validateOvirtCon(url string, insecure bool, caFile, username, password string) error {
+func validateOvirtCon(ctx context.Context, url string, insecure bool, caFile, username, password string) (err error) {
+	_, span := tracing.Start(ctx, "validateOvirtCon", trace.WithAttributes(attribute.String("ovirt.url", url)))
+	defer func() { tracing.End(span, err) }()
+
 	builder := ovirtsdk4.NewConnectionBuilder().
 		URL(url).
 		Username(username).
@@ -250,12 +256,21 @@ func (m *Storage) Remap(storageDomains []Storage) (ok bool, msgs error) {
 			m.SecondaryPath = domain.SecondaryPath
 		}
 		storageDomains[n].Found = true
-		key := m.SecondaryType + "://" + m.SecondaryAddr + ":" + m.SecondaryPath
-		return true, errors.New("storage " + m.PrimaryName + " remapped with name " + m.SecondaryName + " as " + key)
+		return true, errors.New(m.remapped(false))
 	}
 	return false, errors.New("storage map for " + m.PrimaryName + " not found")
 }
 
+// remapped return remap message (primary storage is imported on secondary site or back on failback)
+func (m *Storage) remapped(failback bool) string {
+	if failback {
+		key := m.PrimaryType + "://" + m.PrimaryAddr + ":" + m.PrimaryPath
+		return "storage " + m.SecondaryName + " remapped with name " + m.PrimaryName + " as " + key
+	}
+	key := m.SecondaryType + "://" + m.SecondaryAddr + ":" + m.SecondaryPath
+	return "storage " + m.PrimaryName + " remapped with name " + m.SecondaryName + " as " + key
+}
+
 func (m *Storage) Write(w *bufio.Writer) error {
 	if err := writeEntryLn(w, "- dr_domain_type: ", m.PrimaryType); err != nil {
 		return err
@@ -317,29 +332,116 @@ func (m *Storage) WriteString(buf *strings.Builder) {
 	buf.WriteByte('}')
 }
 
+// warningsHeader start storages messages and warnings in generate output (ended with empty line)
+const warningsHeader = "STORAGES MESSAGES AND WARNINGS:\n"
+
+// Warnings return storages messages and warnings from generate output
+func Warnings(out string) (warnings []string) {
+	if !strings.HasPrefix(out, warningsHeader) {
+		return nil
+	}
+	for _, line := range strings.Split(out[len(warningsHeader):], "\n") {
+		if line == "" {
+			break
+		}
+		warnings = append(warnings, line)
+	}
+	return
+}
+
+// StorageRemap return storages remap summary for failover (or failback) from {dir}/{name}/disaster_recovery_vars.yml
+// (dr_import_storages, written by generate)
+func StorageRemap(name, dir string, failback bool) (remap []string, err error) {
+	if !ValidateName(name) {
+		return nil, ErrNameInvalid
+	}
+	f, err := os.Open(path.Join(dir, name, ansibleDrVarsFile))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var (
+		importPhase importState
+		storage     Storage
+	)
+	flush := func() {
+		if storage.PrimaryType != "" {
+			remap = append(remap, storage.remapped(failback))
+		}
+		storage.Reset()
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		s := scanner.Text()
+		switch importPhase {
+		case importStorage:
+			if strings.HasPrefix(s, "- ") {
+				flush()
+				storage.Set(s[2:])
+			} else if strings.HasPrefix(s, "  ") {
+				storage.Set(s[2:])
+			} else if s != "" {
+				flush()
+				importPhase = importNone
+			}
+		default:
+			if s == "dr_import_storages:" {
+				importPhase = importStorage
+			}
+		}
+	}
+	flush()
+	err = scanner.Err()
+	return
+}
+
 // GenerateVars is OVirt engines API address/credentials
 type GenerateVars struct {
-	PrimaryUrl        string    `json:"site_primary_url"`
-	PrimaryUsername   string    `json:"site_primary_username"`
-	PrimaryPassword   string    `json:"site_primary_password"`
-	SecondaryUrl      string    `json:"site_secondary_url"`
-	SecondaryUsername string    `json:"site_secondary_username"`
-	SecondaryPassword string    `json:"site_secondary_password"`
-	StorageDomains    []Storage `json:"storage_domains"`
+	PrimaryUrl        string `json:"site_primary_url"`
+	PrimaryUsername   string `json:"site_primary_username"`
+	PrimaryPassword   string `json:"site_primary_password"`
+	SecondaryUrl      string `json:"site_secondary_url"`
+	SecondaryUsername string `json:"site_secondary_username"`
+	SecondaryPassword string `json:"site_secondary_password"`
+	// password references (scheme:name), resolved by controller, used instead of passwords
+	PrimaryPasswordRef   string `json:"site_primary_password_ref,omitempty"`
+	SecondaryPasswordRef string `json:"site_secondary_password_ref,omitempty"`
+	// engines CA certificates (PEM), if not set, it's fetched from engine and can be verified with SHA-256 fingerprint
+	PrimaryCa              string    `json:"site_primary_ca,omitempty"`
+	PrimaryCaFingerprint   string    `json:"site_primary_ca_fingerprint,omitempty"`
+	SecondaryCa            string    `json:"site_secondary_ca,omitempty"`
+	SecondaryCaFingerprint string    `json:"site_secondary_ca_fingerprint,omitempty"`
+	StorageDomains         []Storage `json:"storage_domains"`
 }
 
 func (g GenerateVars) Generate(name, dir string) (storages string, out string, err error) {
-	ansiblePath, err := exec.LookPath("ansible-playbook")
-	if err != nil {
-		err = ErrAnsibleNotFound
+	return g.GenerateContext(context.Background(), name, dir)
+}
+
+// GenerateContext generate config in {dir}/{name}
+func (g GenerateVars) GenerateContext(ctx context.Context, name, dir string) (storages string, out string, err error) {
+	if err = executor.Check(); err != nil {
 		return
 	}
 
-	if !validateName(name) {
+	if !ValidateName(name) {
 		err = ErrNameInvalid
 		return
 	}
+
+	start := time.Now()
+	ctx, span := startOperation(ctx, "generate", name)
+	defer func() {
+		metrics.ObserveOperation("generate", name, outcome(err), start)
+		tracing.End(span, err)
+	}()
+
 	template := path.Join(dir, "template")
+	if !utils.DirExists(template) {
+		err = ErrTemplateDirNotExist
+		return
+	}
 	dir = path.Join(dir, name)
 	if utils.DirExists(dir) {
 		err = ErrDirAlreadyExist
@@ -355,40 +457,38 @@ func (g GenerateVars) Generate(name, dir string) (storages string, out string, e
 	primaryCaFile := path.Join(dir, "primary.ca")
 	secondaryCaFile := path.Join(dir, "secondary.ca")
 
-	if !lock.TryLock() {
-		return "", "", ErrInProgress
-	}
-
-	flock := fslock.New(dir + ".lock")
-	if err = flock.TryLock(); err != nil {
-		lock.Unlock()
+	unlock, err := lockConfig(ctx, "generate", name, dir, false)
+	if err != nil {
 		return
 	}
 
-	wg.Add(1)
+	done := metrics.Started("generate")
+	started(ctx)
 
-	go func() {
+	func() {
 		defer func() {
-			lock.Unlock()
-			_ = flock.Unlock()
-			wg.Done()
+			done()
+			unlock()
 		}()
 
-		if err = cp.Copy(template, dir); err != nil {
+		_, copySpan := tracing.Start(ctx, "copyTemplate")
+		err = cp.Copy(template, dir)
+		tracing.End(copySpan, err)
+		if err != nil {
 			return
 		}
 
-		if err = saveCaFile(g.PrimaryUrl, primaryCaFile); err != nil {
+		if err = saveCaFile(ctx, g.PrimaryUrl, g.PrimaryCa, g.PrimaryCaFingerprint, primaryCaFile); err != nil {
 			return
 		}
-		if err = validateOvirtCon(g.PrimaryUrl, false, primaryCaFile, g.PrimaryUsername, g.PrimaryPassword); err != nil {
+		if err = validateOvirtCon(ctx, g.PrimaryUrl, false, primaryCaFile, g.PrimaryUsername, g.PrimaryPassword); err != nil {
 			return
 		}
 
-		if err = saveCaFile(g.SecondaryUrl, secondaryCaFile); err != nil {
+		if err = saveCaFile(ctx, g.SecondaryUrl, g.SecondaryCa, g.SecondaryCaFingerprint, secondaryCaFile); err != nil {
 			return
 		}
-		if err = validateOvirtCon(g.SecondaryUrl, false, secondaryCaFile, g.SecondaryUsername, g.SecondaryPassword); err != nil {
+		if err = validateOvirtCon(ctx, g.SecondaryUrl, false, secondaryCaFile, g.SecondaryUsername, g.SecondaryPassword); err != nil {
 			return
 		}
 
@@ -396,26 +496,28 @@ func (g GenerateVars) Generate(name, dir string) (storages string, out string, e
 			return
 		}
 
-		extraVars := "site=" + g.PrimaryUrl + " username=" + g.PrimaryUsername + " password=" + g.PrimaryPassword +
-			" ca=" + primaryCaFile + " var_file=" + ansibleVarFileTpl
+		extraVars := map[string]string{
+			"site": g.PrimaryUrl, "username": g.PrimaryUsername, "password": g.PrimaryPassword,
+			"ca": primaryCaFile, "var_file": ansibleVarFileTpl,
+		}
 
-		// TODO: reduce verbose ?
-		if out, err = utils.ExecCmd(dir+"/generate.log", time.Minute*10, ansiblePath, ansibleGeneratePlaybook, "-t", ansibleDrTag, "-e", extraVars, "-vvvvv"); err == nil {
+		out, err = runPlaybook(ctx, "generate", name, dir, ansibleGeneratePlaybook, []string{ansibleDrTag}, extraVars)
+		if err == nil {
 			if utils.FileExists(ansibleVarFileTpl) {
+				_, writeSpan := tracing.Start(ctx, "writeVarsFiles")
 				if err = g.writeAnsibleFailbackFile(ansibleFailoverPlaybook, ansibleFailbackPlaybook); err == nil {
 					storages, warnings, err = g.writeAnsibleVarsFile(ansibleVarFileTpl, ansibleVarFile)
 				}
+				tracing.End(writeSpan, err)
 			} else {
 				err = ErrVarFileNotExist
 			}
 		}
 	}()
 
-	wg.Wait()
-
 	if len(warnings) > 0 {
 		var buf strings.Builder
-		buf.WriteString("STORAGES MESSAGES AND WARNINGS:\n")
+		buf.WriteString(warningsHeader)
 		for _, warn := range warnings {
 			buf.WriteString(warn.Error())
 			buf.WriteByte('\n')
@@ -431,50 +533,45 @@ func (g GenerateVars) Generate(name, dir string) (storages string, out string, e
 func (g GenerateVars) Validate() error {
 	var errs Errors
 
-	if g.PrimaryUrl == "" {
-		errs = append(errs, "site_primary_url is empty")
-	} else if !strings.HasPrefix(g.PrimaryUrl, "https://") {
-		errs = append(errs, "site_primary_url is invalid")
-	}
-	if g.PrimaryUsername == "" {
-		errs = append(errs, "site_primary_username is empty")
-	}
-	if g.PrimaryPassword == "" {
-		errs = append(errs, "site_primary_password is empty")
-	}
+	errs = validateUrl(errs, "site_primary_url", g.PrimaryUrl)
+	errs = validateUsername(errs, "site_primary_username", g.PrimaryUsername)
+	errs = validatePassword(errs, "site_primary_password", g.PrimaryPassword, g.PrimaryPasswordRef)
 
-	if g.SecondaryUrl == "" {
-		errs = append(errs, "site_secondary_url is empty")
-	} else if !strings.HasPrefix(g.SecondaryUrl, "https://") {
-		errs = append(errs, "site_secondary_url is invalid")
+	errs = validateUrl(errs, "site_secondary_url", g.SecondaryUrl)
+	errs = validateUsername(errs, "site_secondary_username", g.SecondaryUsername)
+	errs = validatePassword(errs, "site_secondary_password", g.SecondaryPassword, g.SecondaryPasswordRef)
+
+	if g.PrimaryCa != "" {
+		if _, err := caFingerprint([]byte(g.PrimaryCa)); err != nil {
+			errs = append(errs, "site_primary_ca is invalid")
+		}
 	}
-	if g.SecondaryUsername == "" {
-		errs = append(errs, "site_secondary_username is empty")
+	if g.PrimaryCaFingerprint != "" {
+		if _, ok := NormalizeFingerprint(g.PrimaryCaFingerprint); !ok {
+			errs = append(errs, "site_primary_ca_fingerprint is invalid")
+		}
 	}
-	if g.SecondaryPassword == "" {
-		errs = append(errs, "site_secondary_password is empty")
+	if g.SecondaryCa != "" {
+		if _, err := caFingerprint([]byte(g.SecondaryCa)); err != nil {
+			errs = append(errs, "site_secondary_ca is invalid")
+		}
+	}
+	if g.SecondaryCaFingerprint != "" {
+		if _, ok := NormalizeFingerprint(g.SecondaryCaFingerprint); !ok {
+			errs = append(errs, "site_secondary_ca_fingerprint is invalid")
+		}
 	}
 
 	for i, s := range g.StorageDomains {
-		if s.PrimaryType == "" {
-			errs = append(errs, "primary_type["+strconv.Itoa(i)+"] is empty")
-		}
-		if s.PrimaryPath == "" {
-			errs = append(errs, "primary_path["+strconv.Itoa(i)+"] is empty")
-		}
-		if s.PrimaryAddr == "" {
-			errs = append(errs, "primary_addr["+strconv.Itoa(i)+"] is empty")
-		}
+		idx := "[" + strconv.Itoa(i) + "]"
 
-		if s.SecondaryType == "" {
-			errs = append(errs, "secondary_type["+strconv.Itoa(i)+"] is empty")
-		}
-		if s.SecondaryPath == "" {
-			errs = append(errs, "secondary_path["+strconv.Itoa(i)+"] is empty")
-		}
-		if s.SecondaryAddr == "" {
-			errs = append(errs, "secondary_addr["+strconv.Itoa(i)+"] is empty")
-		}
+		errs = validateStorageType(errs, "primary_type"+idx, s.PrimaryType)
+		errs = validateStoragePath(errs, "primary_path"+idx, s.PrimaryType, s.PrimaryPath)
+		errs = validateHost(errs, "primary_addr"+idx, s.PrimaryAddr)
+
+		errs = validateStorageType(errs, "secondary_type"+idx, s.SecondaryType)
+		errs = validateStoragePath(errs, "secondary_path"+idx, s.SecondaryType, s.SecondaryPath)
+		errs = validateHost(errs, "secondary_addr"+idx, s.SecondaryAddr)
 	}
 
 	if len(errs) > 0 {
@@ -483,20 +580,21 @@ func (g GenerateVars) Validate() error {
 	return nil
 }
 
-func (g GenerateVars) writeAnsiblePwdDile(pwdFile string) error {
-	f, err := os.OpenFile(pwdFile, os.O_WRONLY|os.O_CREATE, 0600)
-	if err != nil {
-		return err
+// ResolveSecrets resolve password references to passwords
+func (g *GenerateVars) ResolveSecrets(resolver secrets.Resolver) error {
+	var errs Errors
+
+	errs = resolvePassword(errs, resolver, "site_primary_password_ref", g.PrimaryPasswordRef, &g.PrimaryPassword)
+	errs = resolvePassword(errs, resolver, "site_secondary_password_ref", g.SecondaryPasswordRef, &g.SecondaryPassword)
+
+	if len(errs) > 0 {
+		return errs
 	}
-	var buf bytes.Buffer
-	buf.Grow(128)
-	// TODO: encrypt with ansible vault
-	buf.WriteString("dr_sites_primary_password: ")
-	buf.WriteString(g.PrimaryPassword)
-	buf.WriteString("\ndr_sites_secondary_password: ")
-	buf.WriteString(g.SecondaryPassword)
-	_, err = f.Write(buf.Bytes())
-	return err
+	return nil
+}
+
+func (g GenerateVars) writeAnsiblePwdDile(pwdFile string) error {
+	return writeAnsiblePwdFile(pwdFile, g.PrimaryPassword, g.SecondaryPassword)
 }
 
 type importState int8
@@ -201,3 +201,44 @@ func TestGenerateVars_writeAnsibleFailbackFile(t *testing.T) {
 		t.Fatalf("GenerateVars.writeAnsibleFailbackFile() = %s", cmp.Diff(want, got))
 	}
 }
+
+func TestStorageRemap(t *testing.T) {
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, filename, _, _ := runtime.Caller(0)
+	b, err := os.ReadFile(path.Join(path.Dir(filename), "tests", "disaster_recovery_vars2.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(path.Join(dir, "test"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path.Join(dir, "test", ansibleDrVarsFile), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	remap, err := StorageRemap("test", dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`storage nfstst remapped with name nfstst as nfs://192.168.2.210:/nfs_tst2`}
+	if !reflect.DeepEqual(remap, want) {
+		t.Errorf("StorageRemap(failover) = %q, want %q", remap, want)
+	}
+
+	if remap, err = StorageRemap("test", dir, true); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{`storage nfstst remapped with name nfstst as nfs://192.168.1.210:/nfs_tst`}
+	if !reflect.DeepEqual(remap, want) {
+		t.Errorf("StorageRemap(failback) = %q, want %q", remap, want)
+	}
+
+	if _, err = StorageRemap("test2", dir, false); !os.IsNotExist(err) {
+		t.Errorf("StorageRemap(not exist) error = %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package ovirt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+var (
+	ErrCollectionNotFound = errors.New("ansible collection " + ansibleCollection + " not installed")
+
+	ansibleCollection = "ovirt.ovirt"
+
+	// ansible-galaxy is slow, so collection check result is cached
+	collectionCheckTTL     = time.Minute
+	collectionCheckTimeout = time.Second * 30
+	collectionCheck        struct {
+		lock    sync.Mutex
+		checked time.Time
+		err     error
+	}
+)
+
+// CheckTemplate check template dir exist in {dir}/template
+func CheckTemplate(dir string) error {
+	if !utils.DirExists(path.Join(dir, "template")) {
+		return ErrTemplateDirNotExist
+	}
+	return nil
+}
+
+// CheckAnsible check playbook executor is available (ansible-playbook or ansible-runner is on PATH)
+func CheckAnsible() error {
+	return executor.Check()
+}
+
+// CheckCollection check ovirt.ovirt ansible collection is installed (result is cached)
+func CheckCollection() error {
+	if _, ok := executor.(ContainerExecutor); ok {
+		// collection is installed in image, not on host
+		return nil
+	}
+
+	collectionCheck.lock.Lock()
+	defer collectionCheck.lock.Unlock()
+
+	if time.Since(collectionCheck.checked) < collectionCheckTTL {
+		return collectionCheck.err
+	}
+	collectionCheck.err = checkCollection()
+	collectionCheck.checked = time.Now()
+
+	return collectionCheck.err
+}
+
+func checkCollection() error {
+	galaxyPath, err := exec.LookPath("ansible-galaxy")
+	if err != nil {
+		return errors.New("ansible-galaxy not found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), collectionCheckTimeout)
+	defer cancel()
+
+	// not found collection is reported as warning, so check output
+	out, err := exec.CommandContext(ctx, galaxyPath, "collection", "list", ansibleCollection).Output()
+	if err != nil {
+		return errors.New("ansible-galaxy: " + err.Error())
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if name, _, _ := strings.Cut(scanner.Text(), " "); name == ansibleCollection {
+			return nil
+		}
+	}
+	return ErrCollectionNotFound
+}
@@ -0,0 +1,235 @@
+package ovirt
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+var (
+	// logsDir is a logs history dir in config dir
+	logsDir = "logs"
+	// logTimeFormat is a run time format in history file names
+	logTimeFormat = "20060102T150405.000Z"
+
+	logRetention = LogRetention{Keep: 10}
+)
+
+// LogRetention is a playbook logs history retention
+type LogRetention struct {
+	// Keep is a kept runs count per operation (unlimited if 0)
+	Keep int
+	// MaxAge is a max run age (unlimited if 0)
+	MaxAge time.Duration
+	// Compress is gzip compression for logs in history
+	Compress bool
+}
+
+// SetLogRetention set playbook logs history retention (keep last 10 runs by default)
+func SetLogRetention(r LogRetention) {
+	logRetention = r
+}
+
+// RunLog is a playbook run log
+type RunLog struct {
+	Operation string `json:"operation"`
+	// Time is a log modification time (run end)
+	Time time.Time `json:"time"`
+	// File is a log file path, relative to config dir
+	File       string `json:"file"`
+	Size       int64  `json:"size"`
+	Compressed bool   `json:"compressed,omitempty"`
+	// Result is a run result (success or failed), empty if result is not stored
+	Result  string `json:"result,omitempty"`
+	Current bool   `json:"current,omitempty"`
+}
+
+func gzipFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0640)
+	if err != nil {
+		return
+	}
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+	}
+	return
+}
+
+// historyLog return log file in logs history (relative to config dir) for run, completed at modTime
+// (log modification time), log is moved to history on next run of operation
+func historyLog(operation string, modTime time.Time, compress bool) string {
+	file := path.Join(logsDir, operation+"."+modTime.UTC().Format(logTimeFormat)+".log")
+	if compress {
+		file += ".gz"
+	}
+	return file
+}
+
+// rotateLogs move last operation log and result from config dir to logs history and prune history
+func rotateLogs(dir, operation string, r LogRetention) error {
+	logFile := path.Join(dir, operation+".log")
+	st, err := os.Stat(logFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	historyDir := path.Join(dir, logsDir)
+	if err = os.MkdirAll(historyDir, 0750); err != nil {
+		return err
+	}
+
+	historyFile := path.Join(dir, historyLog(operation, st.ModTime(), r.Compress))
+	prefix := strings.TrimSuffix(strings.TrimSuffix(historyFile, ".gz"), ".log")
+	if r.Compress {
+		if err = gzipFile(logFile, historyFile); err != nil {
+			return err
+		}
+		if err = os.Remove(logFile); err != nil {
+			return err
+		}
+	} else if err = os.Rename(logFile, historyFile); err != nil {
+		return err
+	}
+	if resultFile := resultFile(dir, operation); utils.FileExists(resultFile) {
+		if err = os.Rename(resultFile, prefix+".result.json"); err != nil {
+			return err
+		}
+	}
+
+	return pruneLogs(historyDir, operation, r, time.Now())
+}
+
+// historyRuns return run times (sorted from newest) and files in history dir for operation
+func historyRuns(historyDir, operation string) (runs []string, files map[string][]string, err error) {
+	entries, err := os.ReadDir(historyDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	files = make(map[string][]string)
+	for _, e := range entries {
+		op, rest, ok := strings.Cut(e.Name(), ".")
+		if !ok || op != operation || len(rest) <= len(logTimeFormat) {
+			continue
+		}
+		ts := rest[:len(logTimeFormat)]
+		if _, err := time.Parse(logTimeFormat, ts); err != nil {
+			continue
+		}
+		if _, ok := files[ts]; !ok {
+			runs = append(runs, ts)
+		}
+		files[ts] = append(files[ts], e.Name())
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(runs)))
+	return
+}
+
+// pruneLogs remove runs from history, which exceed retention
+func pruneLogs(historyDir, operation string, r LogRetention, now time.Time) error {
+	runs, files, err := historyRuns(historyDir, operation)
+	if err != nil {
+		return err
+	}
+	for i, ts := range runs {
+		t, _ := time.Parse(logTimeFormat, ts)
+		if (r.Keep > 0 && i >= r.Keep) || (r.MaxAge > 0 && now.Sub(t) > r.MaxAge) {
+			for _, name := range files[ts] {
+				if err = os.Remove(path.Join(historyDir, name)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func readRunResult(file string) string {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	var r struct {
+		Result string `json:"result"`
+	}
+	if err = json.Unmarshal(b, &r); err != nil {
+		return ""
+	}
+	return r.Result
+}
+
+// Logs return playbook run logs for operation (all operations if empty) on {dir}/{name}, sorted from newest
+func Logs(name, dir, operation string) ([]RunLog, error) {
+	if !ValidateName(name) {
+		return nil, ErrNameInvalid
+	}
+	if operation != "" && !resultOperations[operation] {
+		return nil, ErrOperationInvalid
+	}
+	dir = path.Join(dir, name)
+	if !utils.DirExists(dir) {
+		return nil, ErrDirNotExist
+	}
+
+	operations := []string{operation}
+	if operation == "" {
+		operations = []string{"generate", "failover", "failback", "cleanup"}
+	}
+	logs := make([]RunLog, 0, 8)
+	historyDir := path.Join(dir, logsDir)
+	for _, op := range operations {
+		if st, err := os.Stat(path.Join(dir, op+".log")); err == nil {
+			logs = append(logs, RunLog{
+				Operation: op, Time: st.ModTime().UTC(), File: op + ".log", Size: st.Size(),
+				Result: readRunResult(resultFile(dir, op)), Current: true,
+			})
+		}
+		runs, files, err := historyRuns(historyDir, op)
+		if err != nil {
+			return nil, err
+		}
+		for _, ts := range runs {
+			t, _ := time.Parse(logTimeFormat, ts)
+			l := RunLog{Operation: op, Time: t}
+			for _, f := range files[ts] {
+				if strings.HasSuffix(f, ".result.json") {
+					l.Result = readRunResult(path.Join(historyDir, f))
+				} else if st, err := os.Stat(path.Join(historyDir, f)); err == nil {
+					l.File = path.Join(logsDir, f)
+					l.Size = st.Size()
+					l.Compressed = strings.HasSuffix(f, ".gz")
+				}
+			}
+			if l.File != "" {
+				logs = append(logs, l)
+			}
+		}
+	}
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Time.After(logs[j].Time) })
+
+	return logs, nil
+}
@@ -0,0 +1,148 @@
+package ovirt
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func writeRun(t *testing.T, dir, operation, log, result string, mtime time.Time) {
+	t.Helper()
+	logFile := path.Join(dir, operation+".log")
+	if err := os.WriteFile(logFile, []byte(log), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if result != "" {
+		if err := os.WriteFile(resultFile(dir, operation), []byte(`{"result":"`+result+`"}`), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(logFile, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateLogs(t *testing.T) {
+	storeDir := t.TempDir()
+	dir := path.Join(storeDir, "test")
+	if err := os.Mkdir(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	r := LogRetention{Keep: 2, Compress: true}
+
+	// no log, nothing to rotate
+	if err := rotateLogs(dir, "failover", r); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for i := 3; i > 0; i-- {
+		writeRun(t, dir, "failover", "run "+strconv.Itoa(i)+"\n", "failed", now.Add(-time.Duration(i)*time.Hour))
+		if err := rotateLogs(dir, "failover", r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeRun(t, dir, "failover", "current\n", "success", now)
+	writeRun(t, dir, "cleanup", "cleanup\n", "", now.Add(-time.Minute))
+
+	logs, err := Logs("test", storeDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// oldest failover run is pruned
+	want := []RunLog{
+		{Operation: "failover", Time: now, File: "failover.log", Size: 8, Result: "success", Current: true},
+		{Operation: "cleanup", Time: now.Add(-time.Minute), File: "cleanup.log", Size: 8, Current: true},
+		{Operation: "failover", Time: now.Add(-time.Hour), File: "logs/failover." + now.Add(-time.Hour).Format(logTimeFormat) + ".log.gz", Compressed: true, Result: "failed"},
+		{Operation: "failover", Time: now.Add(-2 * time.Hour), File: "logs/failover." + now.Add(-2*time.Hour).Format(logTimeFormat) + ".log.gz", Compressed: true, Result: "failed"},
+	}
+	if len(logs) != len(want) {
+		t.Fatalf("Logs() = %+v, want %+v", logs, want)
+	}
+	for i := range want {
+		if want[i].Compressed {
+			want[i].Size = logs[i].Size
+		}
+		if !logs[i].Time.Equal(want[i].Time) {
+			t.Errorf("Logs()[%d].Time = %v, want %v", i, logs[i].Time, want[i].Time)
+		}
+		logs[i].Time = want[i].Time
+		if logs[i] != want[i] {
+			t.Errorf("Logs()[%d] = %+v, want %+v", i, logs[i], want[i])
+		}
+	}
+
+	f, err := os.Open(path.Join(dir, logs[2].File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "run 1\n" {
+		t.Errorf("compressed log = %q", string(b))
+	}
+
+	if logs, err = Logs("test", storeDir, "generate"); err != nil || len(logs) != 0 {
+		t.Errorf("Logs(generate) = %+v, %v", logs, err)
+	}
+	if _, err = Logs("test", storeDir, "delete"); err != ErrOperationInvalid {
+		t.Errorf("Logs(delete) error = %v", err)
+	}
+	if _, err = Logs("test2", storeDir, ""); err != ErrDirNotExist {
+		t.Errorf("Logs(test2) error = %v", err)
+	}
+}
+
+func TestPruneLogs(t *testing.T) {
+	historyDir := t.TempDir()
+	now := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		ts := now.Add(-time.Duration(i) * 24 * time.Hour).Format(logTimeFormat)
+		for _, name := range []string{"failover." + ts + ".log", "failover." + ts + ".result.json", "cleanup." + ts + ".log"} {
+			if err := os.WriteFile(path.Join(historyDir, name), nil, 0640); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// unlimited
+	if err := pruneLogs(historyDir, "failover", LogRetention{}, now); err != nil {
+		t.Fatal(err)
+	}
+	if runs, _, _ := historyRuns(historyDir, "failover"); len(runs) != 3 {
+		t.Errorf("runs after unlimited prune = %v", runs)
+	}
+
+	if err := pruneLogs(historyDir, "failover", LogRetention{MaxAge: 36 * time.Hour}, now); err != nil {
+		t.Fatal(err)
+	}
+	runs, files, err := historyRuns(historyDir, "failover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || len(files[runs[1]]) != 2 {
+		t.Errorf("runs after age prune = %v, files = %v", runs, files)
+	}
+
+	if err = pruneLogs(historyDir, "failover", LogRetention{Keep: 1}, now); err != nil {
+		t.Fatal(err)
+	}
+	if runs, _, _ = historyRuns(historyDir, "failover"); len(runs) != 1 || runs[0] != now.Format(logTimeFormat) {
+		t.Errorf("runs after count prune = %v", runs)
+	}
+	// other operations are not pruned
+	if runs, _, _ = historyRuns(historyDir, "cleanup"); len(runs) != 3 {
+		t.Errorf("cleanup runs = %v", runs)
+	}
+}
@@ -0,0 +1,340 @@
+package ovirt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+var (
+	ErrVerbosityInvalid = errors.New("verbosity is invalid")
+	ErrTimeoutInvalid   = errors.New("timeout is invalid")
+	ErrForksInvalid     = errors.New("forks is invalid")
+
+	DefaultVerbosity = 5
+	DefaultTimeout   = time.Minute * 10
+
+	// maxVerbosity is a ansible-playbook max verbosity (-vvvvvv)
+	maxVerbosity = 6
+
+	varNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// reservedVars is a extra vars, passed by controller (can't be overridden)
+	reservedVars = map[string]bool{"site": true, "username": true, "password": true, "ca": true, "var_file": true}
+)
+
+// Duration is a time.Duration, decoded from JSON string (like 10m)
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// PlaybookSettings is an ansible-playbook run settings, unset fields are not changed on merge
+type PlaybookSettings struct {
+	// Verbosity is a -v flags count (0-6)
+	Verbosity *int     `json:"verbosity,omitempty"`
+	Timeout   Duration `json:"timeout,omitempty"`
+	// Forks is a --forks value, ansible default if 0
+	Forks     int               `json:"forks,omitempty"`
+	ExtraVars map[string]string `json:"extra_vars,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	// Image is an OCI image for container executor (executor default if empty), can't be set by request
+	Image string `json:"image,omitempty"`
+}
+
+func (s *PlaybookSettings) merge(o *PlaybookSettings) {
+	if o.Verbosity != nil {
+		v := *o.Verbosity
+		s.Verbosity = &v
+	}
+	if o.Timeout > 0 {
+		s.Timeout = o.Timeout
+	}
+	if o.Forks > 0 {
+		s.Forks = o.Forks
+	}
+	if o.Image != "" {
+		s.Image = o.Image
+	}
+	if len(o.ExtraVars) > 0 {
+		vars := make(map[string]string, len(s.ExtraVars)+len(o.ExtraVars))
+		for k, v := range s.ExtraVars {
+			vars[k] = v
+		}
+		for k, v := range o.ExtraVars {
+			vars[k] = v
+		}
+		s.ExtraVars = vars
+	}
+	if len(o.Env) > 0 {
+		env := make(map[string]string, len(s.Env)+len(o.Env))
+		for k, v := range s.Env {
+			env[k] = v
+		}
+		for k, v := range o.Env {
+			env[k] = v
+		}
+		s.Env = env
+	}
+}
+
+// ValidateVerbosity check ansible-playbook verbosity (-v flags count, from 0 to 6)
+func ValidateVerbosity(verbosity int) bool {
+	return verbosity >= 0 && verbosity <= maxVerbosity
+}
+
+func (s *PlaybookSettings) validate(errs Errors) Errors {
+	if s.Verbosity != nil && !ValidateVerbosity(*s.Verbosity) {
+		errs = append(errs, ErrVerbosityInvalid.Error())
+	}
+	if s.Timeout < 0 {
+		errs = append(errs, ErrTimeoutInvalid.Error())
+	}
+	if s.Forks < 0 {
+		errs = append(errs, ErrForksInvalid.Error())
+	}
+	if s.Image != "" {
+		if strings.HasPrefix(s.Image, "-") {
+			errs = append(errs, "image is invalid")
+		} else if err := utils.ValidateLine(s.Image); err != nil {
+			errs = append(errs, "image is invalid: "+err.Error())
+		}
+	}
+	for k, v := range s.ExtraVars {
+		if !varNameRe.MatchString(k) {
+			errs = append(errs, "extra var "+k+" is invalid: name must be identifier")
+		} else if reservedVars[k] {
+			errs = append(errs, "extra var "+k+" is invalid: reserved")
+		} else if err := utils.ValidateLine(v); err != nil {
+			errs = append(errs, "extra var "+k+" is invalid: "+err.Error())
+		}
+	}
+	for k, v := range s.Env {
+		if !varNameRe.MatchString(k) {
+			errs = append(errs, "env "+k+" is invalid: name must be identifier")
+		} else if err := utils.ValidateLine(v); err != nil {
+			errs = append(errs, "env "+k+" is invalid: "+err.Error())
+		}
+	}
+	return errs
+}
+
+// Args return ansible-playbook arguments for settings (verbosity and forks, extra vars are passed by executor)
+func (s *PlaybookSettings) Args() (args []string) {
+	verbosity := DefaultVerbosity
+	if s.Verbosity != nil {
+		verbosity = *s.Verbosity
+	}
+	if verbosity > 0 {
+		v := make([]byte, verbosity+1)
+		v[0] = '-'
+		for i := 1; i < len(v); i++ {
+			v[i] = 'v'
+		}
+		args = append(args, string(v))
+	}
+	if s.Forks > 0 {
+		args = append(args, "--forks", strconv.Itoa(s.Forks))
+	}
+	return
+}
+
+// Environ return ansible-playbook environment (os.Environ with settings env)
+func (s *PlaybookSettings) Environ() []string {
+	if len(s.Env) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(s.Env))
+	for k := range s.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	env := os.Environ()
+	for _, k := range keys {
+		env = append(env, k+"="+s.Env[k])
+	}
+	return env
+}
+
+func (s *PlaybookSettings) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return time.Duration(s.Timeout)
+	}
+	return DefaultTimeout
+}
+
+// PlaybookOverride is a settings for matched configs (path.Match patterns) and operations (all if empty)
+type PlaybookOverride struct {
+	Configs    []string `json:"configs,omitempty"`
+	Operations []string `json:"operations,omitempty"`
+	PlaybookSettings
+}
+
+func (o *PlaybookOverride) match(operation, name string) bool {
+	if len(o.Operations) > 0 {
+		found := false
+		for _, op := range o.Operations {
+			if op == operation {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(o.Configs) == 0 {
+		return true
+	}
+	for _, pattern := range o.Configs {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PlaybookLimits is a limits for per-request settings, setting can't be changed by request if limit is not set
+type PlaybookLimits struct {
+	MaxVerbosity *int     `json:"max_verbosity,omitempty"`
+	MaxTimeout   Duration `json:"max_timeout,omitempty"`
+	MaxForks     int      `json:"max_forks,omitempty"`
+	// ExtraVars and Env is an allowed names (path.Match patterns)
+	ExtraVars []string `json:"extra_vars,omitempty"`
+	Env       []string `json:"env,omitempty"`
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *PlaybookLimits) check(s *PlaybookSettings) (errs Errors) {
+	if s.Verbosity != nil && (l.MaxVerbosity == nil || *s.Verbosity > *l.MaxVerbosity) {
+		errs = append(errs, "verbosity is not allowed")
+	}
+	if s.Timeout > 0 && s.Timeout > l.MaxTimeout {
+		errs = append(errs, "timeout is not allowed: max "+time.Duration(l.MaxTimeout).String())
+	}
+	if s.Forks > 0 && s.Forks > l.MaxForks {
+		errs = append(errs, "forks is not allowed: max "+strconv.Itoa(l.MaxForks))
+	}
+	if s.Image != "" {
+		errs = append(errs, "image is not allowed")
+	}
+	for k := range s.ExtraVars {
+		if !matchAny(l.ExtraVars, k) {
+			errs = append(errs, "extra var "+k+" is not allowed")
+		}
+	}
+	for k := range s.Env {
+		if !matchAny(l.Env, k) {
+			errs = append(errs, "env "+k+" is not allowed")
+		}
+	}
+	return
+}
+
+// PlaybookConfig is an admin-defined playbook settings: defaults, per-operation/per-config overrides (applied in order) and limits for per-request settings
+type PlaybookConfig struct {
+	PlaybookSettings
+	Overrides []PlaybookOverride `json:"overrides,omitempty"`
+	Limits    PlaybookLimits     `json:"limits,omitempty"`
+}
+
+func (cfg *PlaybookConfig) Validate() error {
+	errs := cfg.PlaybookSettings.validate(nil)
+	for i := range cfg.Overrides {
+		errs = cfg.Overrides[i].validate(errs)
+		for _, pattern := range cfg.Overrides[i].Configs {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, "config pattern "+pattern+" is invalid")
+			}
+		}
+	}
+	for _, pattern := range append(cfg.Limits.ExtraVars, cfg.Limits.Env...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, "limits pattern "+pattern+" is invalid")
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// LoadPlaybookConfig load playbook settings from JSON file
+func LoadPlaybookConfig(file string) (cfg PlaybookConfig, err error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		return
+	}
+	err = cfg.Validate()
+	return
+}
+
+// Settings return settings for operation on config, request settings (can be nil) are checked with limits
+func (cfg *PlaybookConfig) Settings(operation, name string, request *PlaybookSettings) (s PlaybookSettings, err error) {
+	if request != nil {
+		errs := request.validate(nil)
+		if len(errs) == 0 {
+			errs = cfg.Limits.check(request)
+		}
+		if len(errs) > 0 {
+			return s, errs
+		}
+	}
+	s.merge(&cfg.PlaybookSettings)
+	for i := range cfg.Overrides {
+		if cfg.Overrides[i].match(operation, name) {
+			s.merge(&cfg.Overrides[i].PlaybookSettings)
+		}
+	}
+	if request != nil {
+		s.merge(request)
+	}
+	return
+}
+
+type settingsKey struct{}
+
+// WithSettings return context with playbook settings for operation
+func WithSettings(ctx context.Context, s PlaybookSettings) context.Context {
+	return context.WithValue(ctx, settingsKey{}, s)
+}
+
+func settings(ctx context.Context) PlaybookSettings {
+	s, _ := ctx.Value(settingsKey{}).(PlaybookSettings)
+	return s
+}
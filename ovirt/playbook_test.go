@@ -0,0 +1,100 @@
+package ovirt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+func TestPlaybookConfig_Settings(t *testing.T) {
+	var cfg PlaybookConfig
+	if err := json.Unmarshal([]byte(`{
+		"timeout": "20m", "env": {"ANSIBLE_CONFIG": "/etc/xrm/ansible.cfg"},
+		"overrides": [
+			{"operations": ["failover", "failback"], "timeout": "1h", "verbosity": 2},
+			{"configs": ["prod-*"], "forks": 20, "extra_vars": {"dr_ignore_error_clean": "true"}}
+		],
+		"limits": {"max_verbosity": 3, "max_timeout": "2h", "extra_vars": ["dr_*"]}
+	}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	v2, v3 := 2, 3
+	tests := []struct {
+		operation string
+		name      string
+		request   *PlaybookSettings
+		want      PlaybookSettings
+		wantErr   string
+	}{
+		{
+			operation: "cleanup", name: "test",
+			want: PlaybookSettings{Timeout: Duration(time.Minute * 20), Env: map[string]string{"ANSIBLE_CONFIG": "/etc/xrm/ansible.cfg"}},
+		},
+		{
+			operation: "failover", name: "prod-1",
+			want: PlaybookSettings{
+				Verbosity: &v2, Timeout: Duration(time.Hour), Forks: 20,
+				ExtraVars: map[string]string{"dr_ignore_error_clean": "true"}, Env: map[string]string{"ANSIBLE_CONFIG": "/etc/xrm/ansible.cfg"},
+			},
+		},
+		{
+			operation: "failover", name: "test",
+			request: &PlaybookSettings{Verbosity: &v3, Timeout: Duration(time.Hour * 2), ExtraVars: map[string]string{"dr_report_file": "/tmp/report"}},
+			want: PlaybookSettings{
+				Verbosity: &v3, Timeout: Duration(time.Hour * 2),
+				ExtraVars: map[string]string{"dr_report_file": "/tmp/report"}, Env: map[string]string{"ANSIBLE_CONFIG": "/etc/xrm/ansible.cfg"},
+			},
+		},
+		{
+			operation: "failover", name: "test",
+			request: &PlaybookSettings{Timeout: Duration(time.Hour * 3), Forks: 5, Env: map[string]string{"ANSIBLE_CONFIG": "/tmp/ansible.cfg"}},
+			wantErr: "timeout is not allowed: max 2h0m0s\nforks is not allowed: max 0\nenv ANSIBLE_CONFIG is not allowed\n",
+		},
+		{
+			operation: "generate", name: "test",
+			request: &PlaybookSettings{ExtraVars: map[string]string{"password": "x"}},
+			wantErr: "extra var password is invalid: reserved\n",
+		},
+	}
+	for i, tt := range tests {
+		got, err := cfg.Settings(tt.operation, tt.name, tt.request)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("[%d] PlaybookConfig.Settings() error = %q, want %q", i, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] PlaybookConfig.Settings() error = %v", i, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("[%d] PlaybookConfig.Settings() = %+v, want %+v", i, got, tt.want)
+		}
+	}
+}
+
+func TestPlaybookSettings_Args(t *testing.T) {
+	v0 := 0
+	tests := []struct {
+		s    PlaybookSettings
+		want []string
+	}{
+		{s: PlaybookSettings{}, want: []string{"-vvvvv"}},
+		{s: PlaybookSettings{Verbosity: &v0}, want: nil},
+		{
+			s:    PlaybookSettings{Forks: 10, ExtraVars: map[string]string{"dr_report_file": "/tmp/report 1"}},
+			want: []string{"-vvvvv", "--forks", "10"},
+		},
+	}
+	for i, tt := range tests {
+		if got := tt.s.Args(); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("[%d] PlaybookSettings.Args() = %q, want %q", i, got, tt.want)
+		}
+	}
+}
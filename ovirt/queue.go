@@ -0,0 +1,244 @@
+package ovirt
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrQueueFull     = errors.New("another operation in progress, operations queue is full")
+	ErrQueueCanceled = errors.New("queued operation canceled")
+
+	// DefaultPriorities is a default operations priorities in queue (higher is started first)
+	DefaultPriorities = map[string]int{"failover": 40, "failback": 30, "cleanup": 20, "generate": 10}
+
+	lock = opQueue{priorities: DefaultPriorities}
+)
+
+// QueueConfig is an operations queue config
+type QueueConfig struct {
+	// MaxDepth is a max queued operations count (queue is disabled if 0, operations on busy controller are rejected with ErrInProgress)
+	MaxDepth int
+	// Priorities is an operations priorities (higher is started first, operations with same priority are started in queue order),
+	// DefaultPriorities is used for operations without priority
+	Priorities map[string]int
+}
+
+// ParsePriorities parse operations priorities in operation:priority format
+func ParsePriorities(s []string) (map[string]int, error) {
+	priorities := make(map[string]int)
+	for _, p := range s {
+		op, v, _ := strings.Cut(p, ":")
+		if !resultOperations[op] {
+			return nil, errors.New("priority " + p + " is invalid: operation is invalid")
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.New("priority " + p + " is invalid: " + err.Error())
+		}
+		priorities[op] = n
+	}
+	return priorities, nil
+}
+
+// SetQueue set operations queue config (queue is disabled by default)
+func SetQueue(cfg QueueConfig) {
+	priorities := make(map[string]int, len(DefaultPriorities)+len(cfg.Priorities))
+	for op, p := range DefaultPriorities {
+		priorities[op] = p
+	}
+	for op, p := range cfg.Priorities {
+		priorities[op] = p
+	}
+
+	lock.mu.Lock()
+	lock.maxDepth = cfg.MaxDepth
+	lock.priorities = priorities
+	lock.closed = false
+	lock.mu.Unlock()
+}
+
+// Queued is a queued operation
+type Queued struct {
+	ID        string    `json:"id,omitempty"`
+	Operation string    `json:"operation"`
+	Name      string    `json:"name"`
+	Priority  int       `json:"priority"`
+	Time      time.Time `json:"time"`
+	// Position is a position in queue (from 1)
+	Position int `json:"position"`
+}
+
+type queueItem struct {
+	Queued
+	ready    chan struct{} // closed, when lock is passed to operation
+	canceled chan struct{} // closed, when operation is removed from queue
+}
+
+// opQueue is an operations lock, waiting operations are queued and got lock by priority
+type opQueue struct {
+	mu         sync.Mutex
+	busy       bool
+	items      []*queueItem // sorted by priority and queue time
+	maxDepth   int
+	priorities map[string]int
+	// closed is set on shutdown, operations are not queued
+	closed bool
+}
+
+// TryLock try to lock without queueing (fails if any operation is queued)
+func (q *opQueue) TryLock() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.busy || len(q.items) > 0 {
+		return false
+	}
+	q.busy = true
+	return true
+}
+
+// Unlock unlock or pass lock to the first queued operation
+func (q *opQueue) Unlock() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		q.busy = false
+		return
+	}
+	item := q.items[0]
+	q.items = q.items[1:]
+	close(item.ready)
+}
+
+func (q *opQueue) remove(item *queueItem) bool {
+	for i, it := range q.items {
+		if it == item {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			close(item.canceled)
+			return true
+		}
+	}
+	return false
+}
+
+// acquire lock, if lock is busy, operation is queued (if queue is enabled) until lock is passed, operation is canceled or ctx is done
+func (q *opQueue) acquire(ctx context.Context, operation, name string) error {
+	q.mu.Lock()
+	if !q.busy && len(q.items) == 0 {
+		q.busy = true
+		q.mu.Unlock()
+		return nil
+	}
+	if q.maxDepth <= 0 || q.closed {
+		q.mu.Unlock()
+		return ErrInProgress
+	}
+	if len(q.items) >= q.maxDepth {
+		q.mu.Unlock()
+		return ErrQueueFull
+	}
+
+	id, queuedFn := queued(ctx)
+	item := &queueItem{
+		Queued: Queued{
+			ID: id, Operation: operation, Name: name, Priority: q.priorities[operation], Time: time.Now().UTC(),
+		},
+		ready:    make(chan struct{}),
+		canceled: make(chan struct{}),
+	}
+	// operations with same priority are started in queue order
+	i := sort.Search(len(q.items), func(i int) bool { return q.items[i].Priority < item.Priority })
+	q.items = append(q.items, nil)
+	copy(q.items[i+1:], q.items[i:])
+	q.items[i] = item
+	q.mu.Unlock()
+
+	if queuedFn != nil {
+		queuedFn()
+	}
+
+	select {
+	case <-item.ready:
+		return nil
+	case <-item.canceled:
+		return ErrQueueCanceled
+	case <-ctx.Done():
+		q.mu.Lock()
+		removed := q.remove(item)
+		q.mu.Unlock()
+		if !removed {
+			// lock already passed or operation canceled
+			select {
+			case <-item.ready:
+				q.Unlock()
+			default:
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+// Queue return queued operations (in start order)
+func Queue() []Queued {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	queue := make([]Queued, len(lock.items))
+	for i, item := range lock.items {
+		queue[i] = item.Queued
+		queue[i].Position = i + 1
+	}
+	return queue
+}
+
+// CancelQueued remove queued operation with id from queue (operation return ErrQueueCanceled), return false if operation is not queued
+func CancelQueued(id string) bool {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	for _, item := range lock.items {
+		if item.ID == id && id != "" {
+			return lock.remove(item)
+		}
+	}
+	return false
+}
+
+// CloseQueue remove all queued operations from queue (new operations are not queued until SetQueue), return canceled operations
+func CloseQueue() []Queued {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	lock.closed = true
+
+	canceled := make([]Queued, 0, len(lock.items))
+	for len(lock.items) > 0 {
+		canceled = append(canceled, lock.items[0].Queued)
+		lock.remove(lock.items[0])
+	}
+	return canceled
+}
+
+type queuedKey struct{}
+
+type queuedHook struct {
+	id string
+	fn func()
+}
+
+// WithQueued return context with queued operation id (for cancel) and callback, called when operation is queued
+func WithQueued(ctx context.Context, id string, fn func()) context.Context {
+	return context.WithValue(ctx, queuedKey{}, queuedHook{id: id, fn: fn})
+}
+
+func queued(ctx context.Context) (string, func()) {
+	h, _ := ctx.Value(queuedKey{}).(queuedHook)
+	return h.id, h.fn
+}
@@ -0,0 +1,208 @@
+package ovirt
+
+import (
+	"context"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParsePriorities(t *testing.T) {
+	priorities, err := ParsePriorities([]string{"generate:50", "cleanup:-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"generate": 50, "cleanup": -1}; !reflect.DeepEqual(priorities, want) {
+		t.Errorf("ParsePriorities() = %v, want %v", priorities, want)
+	}
+	for _, s := range []string{"delete:1", "generate", "generate:high"} {
+		if _, err = ParsePriorities([]string{s}); err == nil {
+			t.Errorf("ParsePriorities(%q) error is nil", s)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	SetQueue(QueueConfig{MaxDepth: 2, Priorities: map[string]int{"cleanup": 50}})
+	defer SetQueue(QueueConfig{})
+
+	ctx := context.Background()
+	if err := lock.acquire(ctx, "generate", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// queue in order: generate, failover (failover must be started first)
+	results := make(map[string]chan error)
+	for _, op := range []string{"generate", "failover"} {
+		queued := make(chan struct{})
+		result := make(chan error, 1)
+		results[op] = result
+		go func(op string) {
+			result <- lock.acquire(WithQueued(ctx, op+"-id", func() { close(queued) }), op, "test")
+		}(op)
+		<-queued
+	}
+	if err := lock.acquire(ctx, "cleanup", "test"); err != ErrQueueFull {
+		t.Errorf("acquire() with full queue error = %v, want %v", err, ErrQueueFull)
+	}
+	if lock.TryLock() {
+		t.Fatal("TryLock() with queued operations = true")
+	}
+
+	queue := Queue()
+	for i := range queue {
+		queue[i].Time = time.Time{}
+	}
+	want := []Queued{
+		{ID: "failover-id", Operation: "failover", Name: "test", Priority: 40, Position: 1},
+		{ID: "generate-id", Operation: "generate", Name: "test", Priority: 10, Position: 2},
+	}
+	if !reflect.DeepEqual(queue, want) {
+		t.Errorf("Queue() = %+v, want %+v", queue, want)
+	}
+
+	if !CancelQueued("generate-id") {
+		t.Error("CancelQueued() = false")
+	}
+	if err := <-results["generate"]; err != ErrQueueCanceled {
+		t.Errorf("canceled acquire() error = %v, want %v", err, ErrQueueCanceled)
+	}
+	if CancelQueued("generate-id") {
+		t.Error("CancelQueued() for not queued = true")
+	}
+
+	// lock is passed to queued operation
+	lock.Unlock()
+	select {
+	case err := <-results["failover"]:
+		if err != nil {
+			t.Errorf("queued acquire() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued operation not started")
+	}
+
+	// queued operation with done context
+	cctx, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+	defer cancel()
+	if err := lock.acquire(cctx, "cleanup", "test"); err != context.DeadlineExceeded {
+		t.Errorf("acquire() with done context error = %v", err)
+	}
+	if queue = Queue(); len(queue) != 0 {
+		t.Errorf("Queue() after context done = %+v", queue)
+	}
+
+	// closed queue
+	queued := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		result <- lock.acquire(WithQueued(ctx, "cleanup-id", func() { close(queued) }), "cleanup", "test")
+	}()
+	<-queued
+	if canceled := CloseQueue(); len(canceled) != 1 || canceled[0].ID != "cleanup-id" || canceled[0].Priority != 50 {
+		t.Errorf("CloseQueue() = %+v", canceled)
+	}
+	if err := <-result; err != ErrQueueCanceled {
+		t.Errorf("acquire() on closed queue error = %v", err)
+	}
+	if err := lock.acquire(ctx, "cleanup", "test"); err != ErrInProgress {
+		t.Errorf("acquire() on closed queue error = %v, want %v", err, ErrInProgress)
+	}
+
+	lock.Unlock()
+	if !lock.TryLock() {
+		t.Fatal("TryLock() = false")
+	}
+	lock.Unlock()
+}
+
+func TestQueue_SameConfig(t *testing.T) {
+	SetQueue(QueueConfig{MaxDepth: 20})
+	defer SetQueue(QueueConfig{})
+
+	dir := t.TempDir()
+	if err := os.Mkdir(path.Join(dir, "test"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	fake := &FakeExecutor{Outputs: map[string]FakeOutput{
+		"failover": {Out: "failover\n", Delay: time.Millisecond * 2},
+		"cleanup":  {Out: "cleanup\n", Delay: time.Millisecond * 2},
+	}}
+	prev := executor
+	SetExecutor(fake)
+	defer SetExecutor(prev)
+
+	// queued operations on same config must got operations and config locks in turn
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := FailoverContext(context.Background(), "test", dir)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := CleanupContext(context.Background(), "test", dir)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("queued operation error = %v", err)
+		}
+	}
+	if runs := fake.Runs(); len(runs) != 20 {
+		t.Errorf("FakeExecutor.Runs() = %d, want 20", len(runs))
+	}
+
+	// config is deleted while operation is queued
+	if err := lock.acquire(context.Background(), "generate", "test"); err != nil {
+		t.Fatal(err)
+	}
+	queued := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		_, err := FailoverContext(WithQueued(context.Background(), "", func() { close(queued) }), "test", dir)
+		result <- err
+	}()
+	<-queued
+	if err := os.RemoveAll(path.Join(dir, "test")); err != nil {
+		t.Fatal(err)
+	}
+	lock.Unlock()
+	if err := <-result; err != ErrDirNotExist {
+		t.Errorf("FailoverContext() for config, deleted while queued, error = %v, want %v", err, ErrDirNotExist)
+	}
+
+	// config is generated while generate is queued
+	if err := os.Mkdir(path.Join(dir, "template"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.acquire(context.Background(), "generate", "test"); err != nil {
+		t.Fatal(err)
+	}
+	queued = make(chan struct{})
+	go func() {
+		_, _, err := GenerateVars{}.GenerateContext(WithQueued(context.Background(), "", func() { close(queued) }), "test", dir)
+		result <- err
+	}()
+	<-queued
+	if err := os.Mkdir(path.Join(dir, "test"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	lock.Unlock()
+	if err := <-result; err != ErrDirAlreadyExist {
+		t.Errorf("GenerateContext() for config, generated while queued, error = %v, want %v", err, ErrDirAlreadyExist)
+	}
+	if !lock.TryLock() {
+		t.Fatal("TryLock() = false")
+	}
+	lock.Unlock()
+}
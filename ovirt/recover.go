@@ -0,0 +1,122 @@
+package ovirt
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/fslock"
+
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+var (
+	orphansLock sync.Mutex
+	orphans     = make(map[string]Orphan)
+
+	// orphanCheckInterval is an orphaned playbook process check interval
+	orphanCheckInterval = time.Second * 5
+)
+
+// Orphan is a playbook process, survived controller restart (config is locked until process exit)
+type Orphan struct {
+	Name      string `json:"name"`
+	Operation string `json:"operation"`
+	PID       int    `json:"pid"`
+	// Since is a detection time
+	Since time.Time `json:"since"`
+}
+
+func (o Orphan) String() string {
+	return o.Name + "/" + o.Operation + " (pid " + strconv.Itoa(o.PID) + ")"
+}
+
+// AdoptOrphan check playbook process for operation on {dir}/{name} (from previous controller run) is still running,
+// if so config stay locked until process exit
+func AdoptOrphan(name, dir, operation string, pid int) (bool, error) {
+	if !ValidateName(name) {
+		return false, ErrNameInvalid
+	}
+	dir = path.Join(dir, name)
+	// all executors pass config dir in playbook command line, so reused pid is not matched
+	match := dir + "/"
+	if !utils.ProcessRunning(pid, match) {
+		return false, nil
+	}
+
+	orphansLock.Lock()
+	defer orphansLock.Unlock()
+	if _, ok := orphans[name]; ok {
+		return true, nil
+	}
+
+	// playbook process inherit lock from previous controller run, so lock can be already held
+	flock := fslock.New(dir + ".lock")
+	err := flock.TryLock()
+	if err != nil && err != fslock.ErrLocked {
+		return true, err
+	}
+	locked := err == nil
+
+	orphans[name] = Orphan{Name: name, Operation: operation, PID: pid, Since: time.Now().UTC()}
+	go func() {
+		for utils.ProcessRunning(pid, match) {
+			time.Sleep(orphanCheckInterval)
+		}
+		if locked {
+			_ = flock.Unlock()
+		}
+		orphansLock.Lock()
+		delete(orphans, name)
+		orphansLock.Unlock()
+	}()
+
+	return true, nil
+}
+
+// Orphans return running orphaned playbook processes, sorted by config name
+func Orphans() []Orphan {
+	orphansLock.Lock()
+	defer orphansLock.Unlock()
+
+	o := make([]Orphan, 0, len(orphans))
+	for _, orphan := range orphans {
+		o = append(o, orphan)
+	}
+	sort.Slice(o, func(i, j int) bool { return o[i].Name < o[j].Name })
+	return o
+}
+
+// CleanStaleLocks remove config lock files in dir, not held by any process, return configs with removed locks
+func CleanStaleLocks(dir string) (names []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".lock") {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ".lock")
+		file := path.Join(dir, e.Name())
+		flock := fslock.New(file)
+		if flock.TryLock() != nil {
+			// held by running playbook process or operation
+			continue
+		}
+		err = os.Remove(file)
+		_ = flock.Unlock()
+		if err != nil {
+			return
+		}
+		names = append(names, name)
+	}
+	return
+}
@@ -0,0 +1,98 @@
+package ovirt
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/juju/fslock"
+)
+
+func TestCleanStaleLocks(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"test.lock", "test2.lock", "test3.log"} {
+		if err := os.WriteFile(path.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flock := fslock.New(path.Join(dir, "test2.lock"))
+	if err := flock.TryLock(); err != nil {
+		t.Fatal(err)
+	}
+	defer flock.Unlock()
+
+	names, err := CleanStaleLocks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"test"}) {
+		t.Errorf("CleanStaleLocks() = %v", names)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name() != "test2.lock" || entries[1].Name() != "test3.log" {
+		t.Errorf("entries after CleanStaleLocks() = %v", entries)
+	}
+
+	if names, err = CleanStaleLocks(path.Join(dir, "not_exist")); err != nil || len(names) != 0 {
+		t.Errorf("CleanStaleLocks(not_exist) = %v, %v", names, err)
+	}
+}
+
+func TestAdoptOrphan(t *testing.T) {
+	orphanCheckInterval = time.Millisecond * 10
+	defer func() { orphanCheckInterval = time.Second * 5 }()
+
+	storeDir := t.TempDir()
+	dir := path.Join(storeDir, "test")
+	if err := os.Mkdir(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	// playbook stand-in with config dir in command line
+	cmd := exec.Command("sh", "-c", "sleep 30; :", path.Join(dir, ansibleFailoverPlaybook))
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = cmd.Process.Kill() }()
+
+	// pid reused by other process
+	if alive, err := AdoptOrphan("test2", storeDir, "failover", cmd.Process.Pid); alive || err != nil {
+		t.Fatalf("AdoptOrphan(test2) = %v, %v", alive, err)
+	}
+
+	alive, err := AdoptOrphan("test", storeDir, "failover", cmd.Process.Pid)
+	if !alive || err != nil {
+		t.Fatalf("AdoptOrphan() = %v, %v", alive, err)
+	}
+	if o := Orphans(); len(o) != 1 || o[0].Name != "test" || o[0].PID != cmd.Process.Pid {
+		t.Errorf("Orphans() = %+v", o)
+	}
+	// config is locked until process exit
+	flock := fslock.New(dir + ".lock")
+	if err = flock.TryLock(); err != fslock.ErrLocked {
+		t.Errorf("config lock error = %v, want %v", err, fslock.ErrLocked)
+	}
+
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+	for i := 0; i < 100 && len(Orphans()) > 0; i++ {
+		time.Sleep(orphanCheckInterval)
+	}
+	if o := Orphans(); len(o) != 0 {
+		t.Fatalf("Orphans() after exit = %+v", o)
+	}
+	if err = flock.TryLock(); err != nil {
+		t.Errorf("config lock after exit error = %v", err)
+	}
+	_ = flock.Unlock()
+
+	if alive, err = AdoptOrphan("test", storeDir, "failover", cmd.Process.Pid); alive || err != nil {
+		t.Errorf("AdoptOrphan() after exit = %v, %v", alive, err)
+	}
+}
@@ -0,0 +1,309 @@
+package ovirt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+var (
+	ErrResultNotFound   = errors.New("playbook result not found")
+	ErrOperationInvalid = errors.New("operation is invalid")
+
+	// task result line: ok: [host], changed: [host] => (item=x) => {...}, fatal: [host]: FAILED! => {...}
+	taskStatusRe = regexp.MustCompile(`^(ok|changed|skipping|failed|fatal): \[([^\]]+)\](?:: (FAILED|UNREACHABLE)!)?(?:(?: =>)? \(item=(.*?)\))?(?: => (.*))?$`)
+	recapRe      = regexp.MustCompile(`^(\S+)\s+: (ok=\d+.*)$`)
+
+	// resultMsgLen is a max stored task message length
+	resultMsgLen = 4096
+
+	resultOperations = map[string]bool{"generate": true, "failover": true, "failback": true, "cleanup": true}
+)
+
+type TaskStatus string
+
+const (
+	TaskOk          TaskStatus = "ok"
+	TaskChanged     TaskStatus = "changed"
+	TaskSkipped     TaskStatus = "skipped"
+	TaskFailed      TaskStatus = "failed"
+	TaskUnreachable TaskStatus = "unreachable"
+)
+
+// taskStatusOrder is a task status priority (task status is the worst of hosts statuses)
+var taskStatusOrder = map[TaskStatus]int{TaskSkipped: 1, TaskOk: 2, TaskChanged: 3, TaskFailed: 4, TaskUnreachable: 5}
+
+// HostResult is a task result on host (or for loop item)
+type HostResult struct {
+	Host    string     `json:"host"`
+	Status  TaskStatus `json:"status"`
+	Item    string     `json:"item,omitempty"`
+	Msg     string     `json:"msg,omitempty"`
+	Ignored bool       `json:"ignored,omitempty"`
+}
+
+type TaskResult struct {
+	Name   string       `json:"name"`
+	Status TaskStatus   `json:"status"`
+	Hosts  []HostResult `json:"hosts"`
+}
+
+type PlayResult struct {
+	Name  string       `json:"name"`
+	Tasks []TaskResult `json:"tasks"`
+}
+
+// FailedTask is a failed (and not ignored) task
+type FailedTask struct {
+	Play   string     `json:"play"`
+	Task   string     `json:"task"`
+	Host   string     `json:"host"`
+	Item   string     `json:"item,omitempty"`
+	Status TaskStatus `json:"status"`
+	Msg    string     `json:"msg,omitempty"`
+}
+
+// HostRecap is a PLAY RECAP counters for host
+type HostRecap struct {
+	Ok          int `json:"ok"`
+	Changed     int `json:"changed"`
+	Unreachable int `json:"unreachable"`
+	Failed      int `json:"failed"`
+	Skipped     int `json:"skipped"`
+	Rescued     int `json:"rescued"`
+	Ignored     int `json:"ignored"`
+}
+
+// PlaybookResult is a structured playbook result, parsed from playbook output and stored as {config_dir}/{operation}.result.json
+type PlaybookResult struct {
+	Operation string               `json:"operation"`
+	Name      string               `json:"name"`
+	Start     time.Time            `json:"start"`
+	Duration  float64              `json:"duration"` // seconds
+	Result    string               `json:"result"`   // success or failed
+	Error     string               `json:"error,omitempty"`
+	Plays     []PlayResult         `json:"plays"`
+	Failed    []FailedTask         `json:"failed,omitempty"`
+	Recap     map[string]HostRecap `json:"recap,omitempty"`
+	// Log is a run log file in logs history (relative to config dir), log is moved to history on next run of operation
+	Log string `json:"log,omitempty"`
+	// storages messages and warnings (generate response only, not stored)
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// resultParser parse ansible-playbook output (default callback) to PlaybookResult
+type resultParser struct {
+	r     *PlaybookResult
+	recap bool
+	// multiline JSON result for last host result (verbose mode)
+	body []string
+}
+
+func (p *resultParser) play() *PlayResult {
+	if len(p.r.Plays) == 0 {
+		p.r.Plays = append(p.r.Plays, PlayResult{Tasks: []TaskResult{}})
+	}
+	return &p.r.Plays[len(p.r.Plays)-1]
+}
+
+func (p *resultParser) task() *TaskResult {
+	play := p.play()
+	if len(play.Tasks) == 0 {
+		return nil
+	}
+	return &play.Tasks[len(play.Tasks)-1]
+}
+
+func (p *resultParser) host() *HostResult {
+	task := p.task()
+	if task == nil || len(task.Hosts) == 0 {
+		return nil
+	}
+	return &task.Hosts[len(task.Hosts)-1]
+}
+
+// resultMsg extract msg from task result JSON, messages, which can contain secrets, are redacted
+func resultMsg(body string) string {
+	var v struct {
+		Msg json.RawMessage `json:"msg"`
+	}
+	if err := json.Unmarshal([]byte(body), &v); err != nil || len(v.Msg) == 0 {
+		return ""
+	}
+	var msg string
+	if err := json.Unmarshal(v.Msg, &msg); err != nil {
+		msg = string(v.Msg)
+	}
+	if len(msg) > resultMsgLen {
+		msg = msg[:resultMsgLen] + "..."
+	}
+	return utils.Redact(msg)
+}
+
+func (p *resultParser) setMsg(body string) {
+	if h := p.host(); h != nil && h.Status != TaskOk && h.Status != TaskSkipped {
+		h.Msg = resultMsg(body)
+	}
+}
+
+// line process playbook output line
+func (p *resultParser) line(s string) {
+	if p.body != nil {
+		p.body = append(p.body, s)
+		if s == "}" {
+			p.setMsg(strings.Join(p.body, "\n"))
+			p.body = nil
+		}
+		return
+	}
+
+	if m := playRe.FindStringSubmatch(s); m != nil {
+		p.recap = false
+		p.r.Plays = append(p.r.Plays, PlayResult{Name: m[1], Tasks: []TaskResult{}})
+	} else if m := taskRe.FindStringSubmatch(s); m != nil {
+		play := p.play()
+		play.Tasks = append(play.Tasks, TaskResult{Name: m[2], Hosts: []HostResult{}})
+	} else if strings.HasPrefix(s, "PLAY RECAP ") {
+		p.recap = true
+	} else if p.recap {
+		if m := recapRe.FindStringSubmatch(s); m != nil {
+			if p.r.Recap == nil {
+				p.r.Recap = make(map[string]HostRecap)
+			}
+			p.r.Recap[m[1]] = parseRecap(m[2])
+		}
+	} else if m := taskStatusRe.FindStringSubmatch(strings.TrimRight(s, " ")); m != nil {
+		task := p.task()
+		if task == nil {
+			return
+		}
+		h := HostResult{Host: m[2], Item: m[4]}
+		switch {
+		case m[3] == "UNREACHABLE":
+			h.Status = TaskUnreachable
+		case m[1] == "fatal" || m[1] == "failed":
+			h.Status = TaskFailed
+		case m[1] == "skipping":
+			h.Status = TaskSkipped
+		default:
+			h.Status = TaskStatus(m[1])
+		}
+		task.Hosts = append(task.Hosts, h)
+		if body := m[5]; body == "{" {
+			p.body = []string{body}
+		} else if strings.HasPrefix(body, "{") {
+			p.setMsg(body)
+		}
+	} else if s == "...ignoring" {
+		if h := p.host(); h != nil {
+			h.Ignored = true
+		}
+	}
+}
+
+// end finalize result (task statuses and failed tasks)
+func (p *resultParser) end() {
+	for i := range p.r.Plays {
+		play := &p.r.Plays[i]
+		for j := range play.Tasks {
+			task := &play.Tasks[j]
+			for _, h := range task.Hosts {
+				status := h.Status
+				if h.Ignored {
+					status = TaskOk
+				}
+				if taskStatusOrder[status] > taskStatusOrder[task.Status] {
+					task.Status = status
+				}
+				if (h.Status == TaskFailed || h.Status == TaskUnreachable) && !h.Ignored {
+					p.r.Failed = append(p.r.Failed, FailedTask{
+						Play: play.Name, Task: task.Name, Host: h.Host, Item: h.Item, Status: h.Status, Msg: h.Msg,
+					})
+				}
+			}
+		}
+	}
+}
+
+func parseRecap(s string) (recap HostRecap) {
+	for _, field := range strings.Fields(s) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		n, _ := strconv.Atoi(v)
+		switch k {
+		case "ok":
+			recap.Ok = n
+		case "changed":
+			recap.Changed = n
+		case "unreachable":
+			recap.Unreachable = n
+		case "failed":
+			recap.Failed = n
+		case "skipped":
+			recap.Skipped = n
+		case "rescued":
+			recap.Rescued = n
+		case "ignored":
+			recap.Ignored = n
+		}
+	}
+	return
+}
+
+func resultFile(dir, operation string) string {
+	return path.Join(dir, operation+".result.json")
+}
+
+// writeResult write result to {dir}/{operation}.result.json (previous result is moved to logs history before run)
+func writeResult(dir string, r *PlaybookResult) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(resultFile(dir, r.Operation), b, 0640)
+}
+
+// ReadResult return last playbook result for operation on {dir}/{name}
+func ReadResult(name, dir, operation string) (r PlaybookResult, err error) {
+	if !ValidateName(name) {
+		err = ErrNameInvalid
+		return
+	}
+	if !resultOperations[operation] {
+		err = ErrOperationInvalid
+		return
+	}
+	b, err := os.ReadFile(resultFile(path.Join(dir, name), operation))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrResultNotFound
+		}
+		return
+	}
+	err = json.Unmarshal(b, &r)
+	return
+}
+
+type resultKey struct{}
+
+// WithResult return context, playbook result is stored to r when playbook is completed
+func WithResult(ctx context.Context, r *PlaybookResult) context.Context {
+	return context.WithValue(ctx, resultKey{}, r)
+}
+
+func setResult(ctx context.Context, r *PlaybookResult) {
+	if p, ok := ctx.Value(resultKey{}).(*PlaybookResult); ok {
+		*p = *r
+	}
+}
@@ -0,0 +1,112 @@
+package ovirt
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_resultParser(t *testing.T) {
+	r := PlaybookResult{Operation: "failover", Name: "test", Plays: []PlayResult{}}
+	p := resultParser{r: &r}
+	for _, line := range []string{
+		"PLAY [oVirt Disaster Recovery] *************************************************",
+		"",
+		"TASK [Gathering Facts] *********************************************************",
+		"task path: /var/lib/xrm-controller/ovirt/test/dr_failover.yml:1",
+		"ok: [localhost]",
+		"TASK [ovirt.ovirt.disaster_recovery : Obtain SSO token] ************************",
+		"changed: [localhost] => {",
+		`    "changed": true,`,
+		`    "msg": "token obtained"`,
+		"}",
+		"TASK [ovirt.ovirt.disaster_recovery : Remove storages] *************************",
+		"skipping: [localhost] => (item=nfs1) ",
+		`failed: [localhost] (item=nfs2) => {"changed": false, "msg": "storage nfs2 is locked"}`,
+		"...ignoring",
+		"TASK [ovirt.ovirt.disaster_recovery : Import storages] *************************",
+		`fatal: [localhost]: FAILED! => {`,
+		`    "changed": false,`,
+		`    "msg": "Fault reason is \"Operation Failed\"."`,
+		"}",
+		"",
+		"PLAY RECAP *********************************************************************",
+		"localhost                  : ok=2    changed=1    unreachable=0    failed=1    skipped=1    rescued=0    ignored=1",
+	} {
+		p.line(line)
+	}
+	p.end()
+
+	want := PlaybookResult{
+		Operation: "failover",
+		Name:      "test",
+		Plays: []PlayResult{
+			{
+				Name: "oVirt Disaster Recovery",
+				Tasks: []TaskResult{
+					{Name: "Gathering Facts", Status: TaskOk, Hosts: []HostResult{{Host: "localhost", Status: TaskOk}}},
+					{
+						Name: "ovirt.ovirt.disaster_recovery : Obtain SSO token", Status: TaskChanged,
+						Hosts: []HostResult{{Host: "localhost", Status: TaskChanged, Msg: "[redacted]"}},
+					},
+					{
+						Name: "ovirt.ovirt.disaster_recovery : Remove storages", Status: TaskOk,
+						Hosts: []HostResult{
+							{Host: "localhost", Status: TaskSkipped, Item: "nfs1"},
+							{Host: "localhost", Status: TaskFailed, Item: "nfs2", Msg: "storage nfs2 is locked", Ignored: true},
+						},
+					},
+					{
+						Name: "ovirt.ovirt.disaster_recovery : Import storages", Status: TaskFailed,
+						Hosts: []HostResult{{Host: "localhost", Status: TaskFailed, Msg: `Fault reason is "Operation Failed".`}},
+					},
+				},
+			},
+		},
+		Failed: []FailedTask{
+			{
+				Play: "oVirt Disaster Recovery", Task: "ovirt.ovirt.disaster_recovery : Import storages", Host: "localhost",
+				Status: TaskFailed, Msg: `Fault reason is "Operation Failed".`,
+			},
+		},
+		Recap: map[string]HostRecap{"localhost": {Ok: 2, Changed: 1, Failed: 1, Skipped: 1, Ignored: 1}},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Fatalf("resultParser =\n%+v\nwant\n%+v", r, want)
+	}
+}
+
+func TestReadResult(t *testing.T) {
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err = ReadResult("test", dir, "failover"); err != ErrResultNotFound {
+		t.Fatalf("ReadResult() = %v, want %v", err, ErrResultNotFound)
+	}
+	if _, err = ReadResult("test", dir, "delete"); err != ErrOperationInvalid {
+		t.Fatalf("ReadResult() = %v, want %v", err, ErrOperationInvalid)
+	}
+	if _, err = ReadResult("../test", dir, "failover"); err != ErrNameInvalid {
+		t.Fatalf("ReadResult() = %v, want %v", err, ErrNameInvalid)
+	}
+
+	if err = os.Mkdir(dir+"/test", 0750); err != nil {
+		t.Fatal(err)
+	}
+	r := PlaybookResult{Operation: "failover", Name: "test", Result: "success", Plays: []PlayResult{}}
+	for i := 0; i < 2; i++ {
+		if err = writeResult(dir+"/test", &r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := ReadResult("test", dir, "failover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, r) {
+		t.Fatalf("ReadResult() = %+v, want %+v", got, r)
+	}
+}
@@ -0,0 +1,82 @@
+package ovirt
+
+import (
+	"context"
+	"os"
+	"path"
+	"regexp"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xrm-tech/xrm-controller/pkg/metrics"
+	"github.com/xrm-tech/xrm-controller/pkg/tracing"
+)
+
+var (
+	// ansible-playbook output (default callback) play and task headers
+	playRe = regexp.MustCompile(`^PLAY \[(.*)\] \*+$`)
+	taskRe = regexp.MustCompile(`^(TASK|RUNNING HANDLER) \[(.*)\] \*+$`)
+)
+
+// runPlaybook run playbook in config dir with executor (with spans for playbook, plays and tasks) and settings from context,
+// output is written to {dir}/{operation}.log and structured result to {dir}/{operation}.result.json
+func runPlaybook(ctx context.Context, operation, name, dir, playbook string, tags []string, vars map[string]string) (out string, err error) {
+	ctx, span := tracing.Start(ctx, "playbook "+operation, trace.WithAttributes(
+		attribute.String("xrm.operation", operation), attribute.String("xrm.name", name),
+	))
+	t := playbookTracer{ctx: ctx}
+	r := PlaybookResult{Operation: operation, Name: name, Plays: []PlayResult{}}
+	p := resultParser{r: &r}
+	// rotation is best-effort, playbook must be started anyway (previous log is renamed to .old on failure)
+	_ = rotateLogs(dir, operation, logRetention)
+	start := time.Now()
+	logFile := path.Join(dir, operation+".log")
+
+	out, err = executor.Run(ctx, &Playbook{
+		Operation: operation,
+		Name:      name,
+		Dir:       dir,
+		Playbook:  playbook,
+		Tags:      tags,
+		Vars:      vars,
+		Settings:  settings(ctx),
+		LogFile:   logFile,
+		OnStart:   processStarted(ctx),
+		OnLine: func(line string) {
+			t.line(line)
+			p.line(line)
+		},
+	})
+
+	t.endPlay()
+	p.end()
+	r.Start = start.UTC()
+	r.Duration = time.Since(start).Seconds()
+	r.Result = outcome(err)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	// log is not changed after run, so history file name (by modification time) is known
+	if st, statErr := os.Stat(logFile); statErr == nil {
+		r.Log = historyLog(operation, st.ModTime(), logRetention.Compress)
+	}
+	// playbook outcome must be kept (failed result write must not report completed operation as failed)
+	if writeErr := writeResult(dir, &r); writeErr != nil {
+		span.RecordError(writeErr)
+		logger.Error().Str("logger", "ovirt").Str("operation", operation).Str("name", name).Err(writeErr).Msg("playbook result write failed")
+	}
+	setResult(ctx, &r)
+	metrics.ObservePlaybook(operation, name, outcome(err), start)
+	tracing.End(span, err)
+
+	return
+}
+
+// startOperation start operation span
+func startOperation(ctx context.Context, operation, name string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "ovirt "+operation, trace.WithAttributes(
+		attribute.String("xrm.operation", operation), attribute.String("xrm.name", name),
+	))
+}
@@ -0,0 +1,60 @@
+package ovirt
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xrm-tech/xrm-controller/pkg/tracing"
+)
+
+var fatalRe = regexp.MustCompile(`^fatal: \[([^\]]*)\]`)
+
+// playbookTracer create spans for ansible plays and tasks, parsed from playbook output
+type playbookTracer struct {
+	ctx     context.Context
+	play    trace.Span
+	playCtx context.Context
+	task    trace.Span
+	taskErr error
+}
+
+func (t *playbookTracer) endTask() {
+	if t.task != nil {
+		tracing.End(t.task, t.taskErr)
+		t.task = nil
+		t.taskErr = nil
+	}
+}
+
+func (t *playbookTracer) endPlay() {
+	t.endTask()
+	if t.play != nil {
+		t.play.End()
+		t.play = nil
+	}
+}
+
+// line process playbook output line
+func (t *playbookTracer) line(s string) {
+	if m := playRe.FindStringSubmatch(s); m != nil {
+		t.endPlay()
+		t.playCtx, t.play = tracing.Start(t.ctx, "play "+m[1], trace.WithAttributes(attribute.String("ansible.play", m[1])))
+	} else if m := taskRe.FindStringSubmatch(s); m != nil {
+		t.endTask()
+		ctx := t.playCtx
+		if ctx == nil {
+			ctx = t.ctx
+		}
+		_, t.task = tracing.Start(ctx, "task "+m[2], trace.WithAttributes(attribute.String("ansible.task", m[2])))
+	} else if strings.HasPrefix(s, "PLAY RECAP ") {
+		t.endPlay()
+	} else if m := fatalRe.FindStringSubmatch(s); m != nil && t.task != nil {
+		// task output can contain secrets, so only host is recorded
+		t.taskErr = errors.New("task failed on " + m[1])
+	}
+}
@@ -0,0 +1,69 @@
+package ovirt
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test_playbookTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(prev)
+
+	ctx, span := startOperation(context.Background(), "failover", "test")
+	pt := playbookTracer{ctx: ctx}
+	for _, line := range []string{
+		"PLAY [oVirt Disaster Recovery] *************************************************",
+		"",
+		"TASK [Gathering Facts] *********************************************************",
+		"task path: /var/lib/xrm-controller/ovirt/test/dr_failover.yml:1",
+		"ok: [localhost]",
+		"TASK [ovirt.ovirt.disaster_recovery : Start failover] **************************",
+		`fatal: [localhost]: FAILED! => {"changed": false, "msg": "password: secret"}`,
+		"PLAY RECAP *********************************************************************",
+		"localhost                  : ok=1    changed=0    unreachable=0    failed=1",
+	} {
+		pt.line(line)
+	}
+	pt.endPlay()
+	span.End()
+
+	spans := recorder.Ended()
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name())
+	}
+	wantNames := []string{
+		"task Gathering Facts",
+		"task ovirt.ovirt.disaster_recovery : Start failover",
+		"play oVirt Disaster Recovery",
+		"ovirt failover",
+	}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("spans = %q, want %q", names, wantNames)
+	}
+
+	play := spans[2]
+	for _, s := range spans[:2] {
+		if s.Parent().SpanID() != play.SpanContext().SpanID() {
+			t.Errorf("span %q parent is not play", s.Name())
+		}
+	}
+	if play.Parent().SpanID() != spans[3].SpanContext().SpanID() {
+		t.Errorf("play parent is not operation")
+	}
+	if spans[0].Status().Code == codes.Error {
+		t.Errorf("span %q status = %v", spans[0].Name(), spans[0].Status())
+	}
+	if status := spans[1].Status(); status.Code != codes.Error || status.Description != "task failed on localhost" {
+		t.Errorf("span %q status = %v", spans[1].Name(), status)
+	}
+}
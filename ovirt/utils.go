@@ -1,6 +1,12 @@
 package ovirt
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
 	"io"
 	"net/http"
 	"os"
@@ -8,8 +14,22 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xrm-tech/xrm-controller/pkg/tracing"
 )
 
+// logger is used for errors, which must not fail operation
+var logger = zerolog.Nop()
+
+// SetLogger set logger for errors, which must not fail operation (disabled by default)
+func SetLogger(l zerolog.Logger) {
+	logger = l
+}
+
 type HttpError struct {
 	Code int
 }
@@ -18,6 +38,46 @@ func (e HttpError) Error() string {
 	return "request failed with " + strconv.Itoa(e.Code)
 }
 
+// CaFingerprintError is a CA certificate fingerprint mismatch
+type CaFingerprintError struct {
+	Url  string
+	Want string
+	Got  string
+}
+
+func (e CaFingerprintError) Error() string {
+	return "CA certificate for " + e.Url + " fingerprint mismatch: want " + e.Want + ", got " + e.Got
+}
+
+// NormalizeFingerprint convert SHA-256 fingerprint (hex, with or without colons) to lowercase hex without colons
+func NormalizeFingerprint(fingerprint string) (string, bool) {
+	fingerprint = strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+	if len(fingerprint) != sha256.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(fingerprint); err != nil {
+		return "", false
+	}
+	return fingerprint, true
+}
+
+// caFingerprint parse PEM CA certificate and return SHA-256 fingerprint, only one certificate is allowed
+// (extra certificates are not covered by fingerprint, so can't be trusted)
+func caFingerprint(caPEM []byte) (string, error) {
+	block, rest := pem.Decode(caPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", ErrCaInvalid
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return "", ErrCaExtraData
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return "", ErrCaInvalid
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 func getCaUrl(ovirtUrl string) string {
 	var out strings.Builder
 	out.Grow(len(ovirtUrl) + 32)
@@ -30,27 +90,82 @@ func getCaUrl(ovirtUrl string) string {
 	return out.String()
 }
 
-func saveCaFile(ovirtUrl string, caFile string) error {
+func fetchCa(ovirtUrl string) ([]byte, error) {
 	caUrl := getCaUrl(ovirtUrl)
 	client := http.Client{
 		Timeout: time.Second * 10,
 	}
 	resp, err := client.Get(caUrl)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return HttpError{resp.StatusCode}
+		return nil, HttpError{resp.StatusCode}
 	}
-	b, err := io.ReadAll(resp.Body)
+	return io.ReadAll(resp.Body)
+}
+
+// saveCaFile save engine CA certificate to caFile. If caPEM is empty, CA is fetched from engine (over plain HTTP),
+// so fingerprint (SHA-256, optional) must be set for protect from MITM
+func saveCaFile(ctx context.Context, ovirtUrl, caPEM, fingerprint, caFile string) (err error) {
+	_, span := tracing.Start(ctx, "saveCaFile", trace.WithAttributes(attribute.String("ovirt.url", ovirtUrl)))
+	defer func() { tracing.End(span, err) }()
+
+	var b []byte
+	if caPEM == "" {
+		if b, err = fetchCa(ovirtUrl); err != nil {
+			return
+		}
+	} else {
+		b = []byte(caPEM)
+	}
+
+	got, err := caFingerprint(b)
 	if err != nil {
-		return err
+		return
 	}
+	if fingerprint != "" {
+		want, ok := NormalizeFingerprint(fingerprint)
+		if !ok {
+			return ErrCaFingerprintInvalid
+		}
+		if want != got {
+			return CaFingerprintError{Url: ovirtUrl, Want: want, Got: got}
+		}
+	}
+
 	return os.WriteFile(caFile, b, 0640)
 }
 
 var nameRe = regexp.MustCompile(`^[a-zA-Z_\-0-9]+$`)
 
-func validateName(name string) bool {
+// ValidateName check config name (also protect from path traversal)
+func ValidateName(name string) bool {
 	return name != "template" && nameRe.MatchString(name)
 }
+
+type startedKey struct{}
+
+// WithStarted return context with callback, called when operation is really started (after config lock acquired)
+func WithStarted(ctx context.Context, fn func()) context.Context {
+	return context.WithValue(ctx, startedKey{}, fn)
+}
+
+func started(ctx context.Context) {
+	if fn, ok := ctx.Value(startedKey{}).(func()); ok {
+		fn()
+	}
+}
+
+type processStartedKey struct{}
+
+// WithProcessStarted return context with callback, called with playbook process id after playbook start
+func WithProcessStarted(ctx context.Context, fn func(pid int)) context.Context {
+	return context.WithValue(ctx, processStartedKey{}, fn)
+}
+
+func processStarted(ctx context.Context) func(pid int) {
+	fn, _ := ctx.Value(processStartedKey{}).(func(pid int))
+	return fn
+}
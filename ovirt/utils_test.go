@@ -0,0 +1,119 @@
+package ovirt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func genCaPEM(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "evil CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func Test_saveCaFile(t *testing.T) {
+	_, filename, _, _ := runtime.Caller(0)
+	caPEM, err := os.ReadFile(path.Join(path.Dir(filename), "tests", "ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := "B2:58:C1:54:74:CA:62:69:2B:DB:57:82:03:C5:3C:B1:02:19:85:D6:10:E1:AD:10:0B:6F:84:CB:93:54:48:AF"
+	invalidFingerprint := "0000000000000000000000000000000000000000000000000000000000000000"
+	// genuine CA with appended attacker CA
+	appendedPEM := append(append([]byte{}, caPEM...), genCaPEM(t)...)
+
+	served := caPEM
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ovirt-engine/services/pki-resource" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(served)
+	}))
+	defer srv.Close()
+	url := "https://" + srv.Listener.Addr().String() + "/ovirt-engine/api"
+
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name        string
+		caPEM       string
+		fingerprint string
+		served      []byte
+		wantErr     bool
+	}{
+		{name: "fetch"},
+		{name: "fetch with fingerprint", fingerprint: fingerprint},
+		{name: "fetch with lowercase fingerprint", fingerprint: "b258c15474ca62692bdb578203c53cb1021985d610e1ad100b6f84cb935448af"},
+		{name: "fetch with fingerprint mismatch", fingerprint: invalidFingerprint, wantErr: true},
+		{name: "fetch with invalid fingerprint", fingerprint: "B2:58", wantErr: true},
+		{name: "pinned", caPEM: string(caPEM)},
+		{name: "pinned with fingerprint", caPEM: string(caPEM), fingerprint: fingerprint},
+		{name: "pinned with fingerprint mismatch", caPEM: string(caPEM), fingerprint: invalidFingerprint, wantErr: true},
+		{name: "pinned invalid", caPEM: "CA", wantErr: true},
+		{name: "fetch with appended certificate", fingerprint: fingerprint, served: appendedPEM, wantErr: true},
+		{name: "pinned with appended certificate", caPEM: string(appendedPEM), fingerprint: fingerprint, wantErr: true},
+		{name: "pinned with trailing data", caPEM: string(caPEM) + "data", wantErr: true},
+		{name: "pinned with trailing spaces", caPEM: string(caPEM) + "\n\n"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caFile := path.Join(dir, "ca"+string(rune('a'+i)))
+			served = caPEM
+			if tt.served != nil {
+				served = tt.served
+			}
+			err := saveCaFile(context.Background(), url, tt.caPEM, tt.fingerprint, caFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("saveCaFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				b, err := os.ReadFile(caFile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := string(caPEM)
+				if tt.caPEM != "" {
+					want = tt.caPEM
+				}
+				if string(b) != want {
+					t.Errorf("saveCaFile() write %q", string(b))
+				}
+			} else if _, statErr := os.Stat(caFile); statErr == nil {
+				t.Errorf("saveCaFile() must not write CA on error")
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package ovirt
+
+import (
+	"regexp"
+
+	"github.com/xrm-tech/xrm-controller/pkg/secrets"
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+// oVirt username is user@domain or user@domain@profile (like admin@internal or admin@ovirt@internalsso)
+var usernameRe = regexp.MustCompile(`^[\w.\-]+@[\w.\-]+(@[\w.\-]+)?$`)
+
+// storageTypes is a storage domain types, supported by oVirt disaster recovery
+var storageTypes = map[string]bool{
+	"nfs":       true,
+	"glusterfs": true,
+	"posixfs":   true,
+	"iscsi":     true,
+	"fcp":       true,
+}
+
+func validateUrl(errs Errors, field, v string) Errors {
+	if v == "" {
+		return append(errs, field+" is empty")
+	}
+	if err := utils.ValidateHttpsUrl(v); err != nil {
+		return append(errs, field+" is invalid: "+err.Error())
+	}
+	return errs
+}
+
+func validateUsername(errs Errors, field, v string) Errors {
+	if v == "" {
+		return append(errs, field+" is empty")
+	}
+	if err := utils.ValidateLine(v); err != nil {
+		return append(errs, field+" is invalid: "+err.Error())
+	}
+	if !usernameRe.MatchString(v) {
+		return append(errs, field+" is invalid: must be in user@domain format")
+	}
+	return errs
+}
+
+// validatePassword check password or password reference (only one must be set)
+func validatePassword(errs Errors, field, password, ref string) Errors {
+	if ref != "" {
+		if password != "" {
+			return append(errs, field+" and "+field+"_ref are both set")
+		}
+		if err := utils.ValidateLine(ref); err != nil {
+			return append(errs, field+"_ref is invalid: "+err.Error())
+		}
+		return errs
+	}
+	if password == "" {
+		return append(errs, field+" is empty")
+	}
+	if utils.HasControlChars(password) {
+		return append(errs, field+" is invalid: "+utils.ErrControlChars.Error())
+	}
+	return errs
+}
+
+func validateHost(errs Errors, field, v string) Errors {
+	if v == "" {
+		return append(errs, field+" is empty")
+	}
+	if err := utils.ValidateHost(v); err != nil {
+		return append(errs, field+" is invalid: "+err.Error())
+	}
+	return errs
+}
+
+func validateStorageType(errs Errors, field, v string) Errors {
+	if v == "" {
+		return append(errs, field+" is empty")
+	}
+	if !storageTypes[v] {
+		return append(errs, field+" is invalid: unsupported storage type")
+	}
+	return errs
+}
+
+// validateStoragePath check storage path (must be absolute for nfs)
+func validateStoragePath(errs Errors, field, storageType, v string) Errors {
+	if v == "" {
+		return append(errs, field+" is empty")
+	}
+	var err error
+	if storageType == "nfs" {
+		err = utils.ValidateAbsPath(v)
+	} else {
+		err = utils.ValidateLine(v)
+	}
+	if err != nil {
+		return append(errs, field+" is invalid: "+err.Error())
+	}
+	return errs
+}
+
+// resolvePassword resolve password reference (if set), resolved password is also checked
+func resolvePassword(errs Errors, resolver secrets.Resolver, field, ref string, password *string) Errors {
+	if ref == "" {
+		return errs
+	}
+	v, err := resolver.Resolve(ref)
+	if err != nil {
+		return append(errs, field+": "+err.Error())
+	}
+	if utils.HasControlChars(v) {
+		return append(errs, field+": resolved password "+utils.ErrControlChars.Error())
+	}
+	*password = v
+	return errs
+}
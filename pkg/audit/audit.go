@@ -0,0 +1,341 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+var (
+	ErrClosed = errors.New("audit log closed")
+
+	// brokenSuffix is a suffix for files with broken records, moved from log on recovery
+	brokenSuffix = ".broken."
+
+	// maxLine is a max record size
+	maxLine = 1024 * 1024
+)
+
+// ChainError is a hash chain verification error
+type ChainError struct {
+	Seq    uint64
+	Reason string
+}
+
+func (e ChainError) Error() string {
+	return "audit record " + strconv.FormatUint(e.Seq, 10) + ": " + e.Reason
+}
+
+// Record is an audit record
+type Record struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Username  string    `json:"username"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	Operation string    `json:"operation"`
+	Name      string    `json:"name,omitempty"`
+	Status    string    `json:"status"`
+	Code      int       `json:"code"`
+	Error     string    `json:"error,omitempty"`
+	Duration  float64   `json:"duration"` // seconds
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// hash calculate record hash (sha256 of record without hash, chained with previous record hash)
+func (r *Record) hash() (string, error) {
+	hash := r.Hash
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	r.Hash = hash
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Filter is a query filter, empty fields are ignored
+type Filter struct {
+	From      time.Time
+	Until     time.Time
+	Username  string
+	Name      string
+	Operation string
+	Limit     int // return last records, if set
+}
+
+func (f *Filter) Match(r *Record) bool {
+	if !f.From.IsZero() && r.Time.Before(f.From) {
+		return false
+	}
+	if !f.Until.IsZero() && !r.Time.Before(f.Until) {
+		return false
+	}
+	if f.Username != "" && f.Username != r.Username {
+		return false
+	}
+	if f.Name != "" && f.Name != r.Name {
+		return false
+	}
+	if f.Operation != "" && f.Operation != r.Operation {
+		return false
+	}
+	return true
+}
+
+// Log is an append-only audit log (JSON lines) with hash chaining
+type Log struct {
+	lock     sync.Mutex
+	path     string
+	f        *os.File
+	seq      uint64
+	lastHash string
+	// recovered is a broken last record error (truncated on open)
+	recovered error
+}
+
+// scan read records, broken records (not parsed) are passed with err, off is a record line offset
+func scan(path string, fn func(r *Record, off int64, err error) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var off int64
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 4096), maxLine)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var r Record
+		if err = fn(&r, off, json.Unmarshal(line, &r)); err != nil {
+			return err
+		}
+		off += int64(len(line)) + 1
+	}
+	return scanner.Err()
+}
+
+// Open open (or create) audit log and restore hash chain state.
+// Broken records at the end of log (partially written on crash) are moved to {path}.broken.{unix time} file
+// (kept as evidence, reported by Verify) and truncated, see Recovered.
+// Broken records in the middle of log are skipped (and reported by Verify).
+func Open(path string) (*Log, error) {
+	l := &Log{path: path}
+	var (
+		broken    int64 = -1 // offset of broken records at the end of log
+		brokenErr error
+	)
+	if err := scan(path, func(r *Record, off int64, err error) error {
+		if err != nil {
+			if broken == -1 {
+				broken = off
+				brokenErr = err
+			}
+			return nil
+		}
+		broken = -1
+		l.seq = r.Seq
+		l.lastHash = r.Hash
+		return nil
+	}); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if broken != -1 {
+		brokenFile, err := moveTail(path, broken)
+		if err != nil {
+			return nil, err
+		}
+		l.recovered = errors.New("broken last record at offset " + strconv.FormatInt(broken, 10) + " moved to " + brokenFile + ": " + brokenErr.Error())
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	// last record is written without line end
+	if st, err := f.Stat(); err == nil && st.Size() > 0 {
+		b := make([]byte, 1)
+		if _, err = f.ReadAt(b, st.Size()-1); err == nil && b[0] != '\n' {
+			_, err = f.Write([]byte{'\n'})
+		}
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	l.f = f
+
+	return l, nil
+}
+
+// moveTail copy log tail from offset to side file and truncate log, return side file
+func moveTail(path string, offset int64) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	if _, err = in.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	brokenFile := path + brokenSuffix + strconv.FormatInt(time.Now().Unix(), 10)
+	out, err := os.OpenFile(brokenFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return brokenFile, os.Truncate(path, offset)
+}
+
+// BrokenError is a broken records, moved from log on recovery (reported until files are removed)
+type BrokenError struct {
+	Files []string
+}
+
+func (e BrokenError) Error() string {
+	return "broken records moved from audit log on recovery: " + strings.Join(e.Files, ", ")
+}
+
+// Recovered return error for broken last record, moved from log on Open (nil if log was not broken)
+func (l *Log) Recovered() error {
+	return l.recovered
+}
+
+// Append add record to log (sequence and hashes are set by log)
+func (l *Log) Append(r Record) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.f == nil {
+		return ErrClosed
+	}
+
+	r.Seq = l.seq + 1
+	r.PrevHash = l.lastHash
+	hash, err := r.hash()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	b, err := json.Marshal(&r)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if _, err = l.f.Write(b); err != nil {
+		return err
+	}
+	if err = l.f.Sync(); err != nil {
+		return err
+	}
+	l.seq = r.Seq
+	l.lastHash = r.Hash
+
+	return nil
+}
+
+// Query return records, matched by filter
+func (l *Log) Query(filter Filter) ([]Record, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var (
+		records = make([]Record, 0, 32)
+		start   int // first record in ring buffer (if limit reached)
+	)
+	err := scan(l.path, func(r *Record, _ int64, err error) error {
+		if err == nil && filter.Match(r) {
+			if filter.Limit > 0 && len(records) == filter.Limit {
+				// keep last records, overwrite oldest
+				records[start] = *r
+				start = (start + 1) % filter.Limit
+			} else {
+				records = append(records, *r)
+			}
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if start > 0 {
+		ordered := make([]Record, 0, len(records))
+		ordered = append(ordered, records[start:]...)
+		records = append(ordered, records[:start]...)
+	}
+	return records, nil
+}
+
+// Verify check hash chain, return records count or ChainError for first broken record,
+// or BrokenError, if broken records were moved from log on recovery
+func (l *Log) Verify() (n uint64, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var prevHash string
+	err = scan(l.path, func(r *Record, _ int64, err error) error {
+		n++
+		if err != nil {
+			return ChainError{Seq: n, Reason: "record is broken: " + err.Error()}
+		}
+		if r.Seq != n {
+			return ChainError{Seq: r.Seq, Reason: "sequence broken, want " + strconv.FormatUint(n, 10)}
+		}
+		if r.PrevHash != prevHash {
+			return ChainError{Seq: r.Seq, Reason: "previous hash mismatch"}
+		}
+		hash, err := r.hash()
+		if err != nil {
+			return err
+		}
+		if hash != r.Hash {
+			return ChainError{Seq: r.Seq, Reason: "hash mismatch"}
+		}
+		prevHash = r.Hash
+		return nil
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	if err == nil {
+		if files, _ := filepath.Glob(l.path + brokenSuffix + "*"); len(files) > 0 {
+			err = BrokenError{Files: files}
+		}
+	}
+	return
+}
+
+func (l *Log) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
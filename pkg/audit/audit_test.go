@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "audit.log")
+
+	l, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Time: start, Username: "admin", Operation: "generate", Name: "test", Status: "success", Code: 200, Duration: 1.5},
+		{Time: start.Add(time.Minute), Username: "oper", Operation: "failover", Name: "test", Status: "failed", Code: 500, Error: "failed"},
+	}
+	for _, r := range records {
+		if err = l.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopen must continue hash chain
+	if l, err = Open(file); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err = l.Append(Record{Time: start.Add(time.Hour), Username: "admin", Operation: "delete", Name: "test2", Status: "success", Code: 200}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := l.Verify(); n != 3 || err != nil {
+		t.Fatalf("Log.Verify() = %d, %v", n, err)
+	}
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		wantSeq []uint64
+	}{
+		{name: "all", wantSeq: []uint64{1, 2, 3}},
+		{name: "username", filter: Filter{Username: "admin"}, wantSeq: []uint64{1, 3}},
+		{name: "name", filter: Filter{Name: "test"}, wantSeq: []uint64{1, 2}},
+		{name: "operation", filter: Filter{Operation: "failover"}, wantSeq: []uint64{2}},
+		{name: "time", filter: Filter{From: start.Add(time.Minute), Until: start.Add(time.Hour)}, wantSeq: []uint64{2}},
+		{name: "limit", filter: Filter{Limit: 2}, wantSeq: []uint64{2, 3}},
+		{name: "limit 1", filter: Filter{Limit: 1}, wantSeq: []uint64{3}},
+		{name: "limit with filter", filter: Filter{Name: "test", Limit: 1}, wantSeq: []uint64{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := l.Query(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seq := make([]uint64, 0, len(got))
+			for _, r := range got {
+				seq = append(seq, r.Seq)
+			}
+			if len(seq) != len(tt.wantSeq) {
+				t.Fatalf("Log.Query() = %v, want %v", seq, tt.wantSeq)
+			}
+			for i := range seq {
+				if seq[i] != tt.wantSeq[i] {
+					t.Fatalf("Log.Query() = %v, want %v", seq, tt.wantSeq)
+				}
+			}
+		})
+	}
+
+	// tamper
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(file, []byte(strings.Replace(string(b), `"username":"oper"`, `"username":"admin"`, 1)), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Verify(); err == nil || err.Error() != "audit record 2: hash mismatch" {
+		t.Fatalf("Log.Verify() must fail on tampered record, got %v", err)
+	}
+}
+
+func TestLogRecover(t *testing.T) {
+	file := path.Join(t.TempDir(), "audit.log")
+
+	l, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err = l.Append(Record{Time: start.Add(time.Duration(i) * time.Minute), Username: "admin", Operation: "generate", Status: "success"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// partially written on crash
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteString(`{"seq":3,"time":"2023-06-`); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if l, err = Open(file); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err = l.Recovered(); err == nil || !strings.HasPrefix(err.Error(), "broken last record at offset ") {
+		t.Errorf("Log.Recovered() = %v", err)
+	}
+	if err = l.Append(Record{Time: start.Add(time.Hour), Username: "admin", Operation: "delete", Status: "success"}); err != nil {
+		t.Fatal(err)
+	}
+	// broken record is kept and reported until removed
+	n, err := l.Verify()
+	brokenErr, ok := err.(BrokenError)
+	if n != 3 || !ok || len(brokenErr.Files) != 1 {
+		t.Fatalf("Log.Verify() = %d, %v", n, err)
+	}
+	if b, err := os.ReadFile(brokenErr.Files[0]); err != nil || string(b) != `{"seq":3,"time":"2023-06-` {
+		t.Errorf("broken records file = %q, %v", string(b), err)
+	}
+	if err = os.Remove(brokenErr.Files[0]); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := l.Verify(); n != 3 || err != nil {
+		t.Fatalf("Log.Verify() = %d, %v", n, err)
+	}
+
+	// broken record in the middle of log
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	lines[1] = lines[1][:10] + "\n"
+	if err = os.WriteFile(file, []byte(strings.Join(lines, "")), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Verify(); err == nil || !strings.HasPrefix(err.Error(), "audit record 2: record is broken") {
+		t.Fatalf("Log.Verify() must fail on broken record, got %v", err)
+	}
+	if records, err := l.Query(Filter{}); err != nil || len(records) != 2 {
+		t.Errorf("Log.Query() = %+v, %v", records, err)
+	}
+}
@@ -0,0 +1,373 @@
+package jobs
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+var (
+	ErrClosed   = errors.New("jobs store closed")
+	ErrNotFound = errors.New("job not found")
+
+	// maxLine is a max record size
+	maxLine = 16 * 1024 * 1024
+	// compactMin is a min stale records count in store file for compaction
+	compactMin = 1000
+)
+
+type Status string
+
+const (
+	StatusQueued  Status = "queued"
+	StatusRunning Status = "running"
+	StatusSuccess Status = "success"
+	StatusFailed  Status = "failed"
+	// StatusInterrupted is a status for job, interrupted by controller restart
+	StatusInterrupted Status = "interrupted"
+	// StatusCanceled is a status for job, canceled while queued
+	StatusCanceled Status = "canceled"
+)
+
+// Job is an operation run
+type Job struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Operation string `json:"operation"`
+	Username  string `json:"username"`
+	// Queued is a queue time (if job was queued)
+	Queued *time.Time `json:"queued,omitempty"`
+	// Start is a start time (queue time for queued or canceled job)
+	Start  time.Time  `json:"start"`
+	End    *time.Time `json:"end,omitempty"`
+	Status Status     `json:"status"`
+	// PID is a playbook process id
+	PID int `json:"pid,omitempty"`
+	// ExitCode is a playbook exit code (-1 if playbook was not completed)
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+	// Result is a structured playbook result
+	Result json.RawMessage `json:"result,omitempty"`
+	// Log is a playbook log file, relative to store dir
+	Log string `json:"log,omitempty"`
+	// QueuePosition is a position in operations queue for queued job (set on query, not stored)
+	QueuePosition int `json:"queue_position,omitempty"`
+}
+
+// NewID return new job id
+func NewID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Filter is a query filter, empty fields are ignored
+type Filter struct {
+	From      time.Time
+	Until     time.Time
+	Username  string
+	Name      string
+	Operation string
+	Status    Status
+	// Offset is a skipped jobs count, Limit is a max returned jobs count (all if 0)
+	Offset int
+	Limit  int
+}
+
+func (f *Filter) Match(j *Job) bool {
+	if !f.From.IsZero() && j.Start.Before(f.From) {
+		return false
+	}
+	if !f.Until.IsZero() && !j.Start.Before(f.Until) {
+		return false
+	}
+	if f.Username != "" && f.Username != j.Username {
+		return false
+	}
+	if f.Name != "" && f.Name != j.Name {
+		return false
+	}
+	if f.Operation != "" && f.Operation != j.Operation {
+		return false
+	}
+	if f.Status != "" && f.Status != j.Status {
+		return false
+	}
+	return true
+}
+
+// Retention is a jobs history retention, queued and running jobs are always kept
+type Retention struct {
+	// Keep is a kept jobs count (unlimited if 0)
+	Keep int
+	// MaxAge is a max job age, by start time (unlimited if 0)
+	MaxAge time.Duration
+}
+
+// Store is a persistent jobs store (JSON lines with job snapshots, last snapshot wins), jobs are also kept in memory
+type Store struct {
+	lock      sync.Mutex
+	path      string
+	f         *os.File
+	jobs      []*Job // sorted by start
+	index     map[string]*Job
+	retention Retention
+	// records is a records count in store file
+	records int
+	// recovered is a skipped broken records error (on open)
+	recovered error
+}
+
+// scan read job snapshots, broken records (not parsed) are passed with err
+func scan(path string, fn func(j *Job, err error) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 4096), maxLine)
+	for scanner.Scan() {
+		var j Job
+		if err = fn(&j, json.Unmarshal(scanner.Bytes(), &j)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func writeJob(f *os.File, j *Job) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	_, err = f.Write(b)
+	return err
+}
+
+func (j *Job) active() bool {
+	return j.Status == StatusQueued || j.Status == StatusRunning
+}
+
+// prune remove jobs, which exceed retention (queued and running jobs are kept)
+func (s *Store) prune(now time.Time) {
+	if s.retention.Keep <= 0 && s.retention.MaxAge <= 0 {
+		return
+	}
+	var n, pruned int
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		j := s.jobs[i]
+		n++
+		if !j.active() && ((s.retention.Keep > 0 && n > s.retention.Keep) || (s.retention.MaxAge > 0 && now.Sub(j.Start) > s.retention.MaxAge)) {
+			delete(s.index, j.ID)
+			s.jobs[i] = nil
+			pruned++
+		}
+	}
+	if pruned == 0 {
+		return
+	}
+	jobs := s.jobs[:0]
+	for _, j := range s.jobs {
+		if j != nil {
+			jobs = append(jobs, j)
+		}
+	}
+	for i := len(jobs); i < len(s.jobs); i++ {
+		s.jobs[i] = nil
+	}
+	s.jobs = jobs
+}
+
+// compact apply retention and rewrite store file with last job snapshots only
+func (s *Store) compact() error {
+	s.prune(time.Now())
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	for _, j := range s.jobs {
+		if err = writeJob(f, j); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	s.records = len(s.jobs)
+	return nil
+}
+
+func (s *Store) put(j *Job) {
+	if old, ok := s.index[j.ID]; ok {
+		if old.Start.Equal(j.Start) {
+			*old = *j
+			return
+		}
+		// start changed (queued job is started), so reinsert for keep order
+		for i := range s.jobs {
+			if s.jobs[i] == old {
+				s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+				break
+			}
+		}
+	}
+	s.index[j.ID] = j
+	i := sort.Search(len(s.jobs), func(i int) bool { return s.jobs[i].Start.After(j.Start) })
+	s.jobs = append(s.jobs, nil)
+	copy(s.jobs[i+1:], s.jobs[i:])
+	s.jobs[i] = j
+}
+
+// Open open (or create) jobs store, load jobs and apply retention.
+// Broken records (like partially written on crash) are skipped and removed on store compaction, see Recovered.
+func Open(path string, r Retention) (*Store, error) {
+	s := &Store{path: path, index: make(map[string]*Job), retention: r}
+	var (
+		broken    int
+		brokenErr error
+	)
+	if err := scan(path, func(j *Job, err error) error {
+		if err != nil {
+			if broken == 0 {
+				brokenErr = err
+			}
+			broken++
+			return nil
+		}
+		s.put(j)
+		return nil
+	}); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if broken > 0 {
+		s.recovered = errors.New(strconv.Itoa(broken) + " broken records skipped: " + brokenErr.Error())
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	s.f = f
+
+	return s, nil
+}
+
+// Recovered return error for broken records, skipped on Open (nil if store was not broken)
+func (s *Store) Recovered() error {
+	return s.recovered
+}
+
+// Put add or update job
+func (s *Store) Put(j Job) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.f == nil {
+		return ErrClosed
+	}
+	if err := writeJob(s.f, &j); err != nil {
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	s.records++
+	s.put(&j)
+	s.prune(time.Now())
+
+	// store file contain all job snapshots (and pruned jobs), so compact it, when stale records dominate
+	if s.records-len(s.jobs) > compactMin && s.records >= 2*len(s.jobs) {
+		if err := s.reopen(); err != nil {
+			return errors.New("compaction: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// reopen compact store file and reopen it for append
+func (s *Store) reopen() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	s.f = nil
+	err := s.compact()
+	// store file must be reopened anyway (previous file is kept, if compaction failed)
+	f, openErr := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if openErr != nil {
+		return openErr
+	}
+	s.f = f
+	if err != nil {
+		// retry after next compactMin records
+		s.records = len(s.jobs)
+	}
+	return err
+}
+
+// Get return job by id
+func (s *Store) Get(id string) (Job, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if j, ok := s.index[id]; ok {
+		return *j, nil
+	}
+	return Job{}, ErrNotFound
+}
+
+// Query return jobs (newest first), matched by filter, and matched jobs count (before offset and limit)
+func (s *Store) Query(filter Filter) (jobs []Job, total int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	jobs = make([]Job, 0, 32)
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		j := s.jobs[i]
+		if !filter.Match(j) {
+			continue
+		}
+		total++
+		if total > filter.Offset && (filter.Limit == 0 || len(jobs) < filter.Limit) {
+			jobs = append(jobs, *j)
+		}
+	}
+	return
+}
+
+func (s *Store) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
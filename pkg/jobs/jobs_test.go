@@ -0,0 +1,202 @@
+package jobs
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	file := path.Join(t.TempDir(), "jobs.jsonl")
+
+	s, err := Open(file, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(time.Minute)
+	jobs := []Job{
+		{ID: "1", Name: "test", Operation: "generate", Username: "admin", Start: start, Status: StatusRunning, ExitCode: -1},
+		{ID: "2", Name: "test", Operation: "failover", Username: "oper", Start: start.Add(time.Hour), Status: StatusRunning, ExitCode: -1},
+		{ID: "3", Name: "test2", Operation: "failover", Username: "oper", Start: start.Add(30 * time.Minute), Status: StatusRunning, ExitCode: -1},
+	}
+	for _, j := range jobs {
+		if err = s.Put(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// completion
+	jobs[0].End = &end
+	jobs[0].Status = StatusSuccess
+	jobs[0].ExitCode = 0
+	jobs[0].Result = []byte(`{"result":"success"}`)
+	if err = s.Put(jobs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Put(jobs[1]); err != ErrClosed {
+		t.Fatalf("Store.Put() after close error = %v", err)
+	}
+
+	// reopen must restore jobs (last snapshots)
+	if s, err = Open(file, Retention{}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	j, err := s.Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(j, jobs[0]) {
+		t.Errorf("Store.Get() = %+v, want %+v", j, jobs[0])
+	}
+	if _, err = s.Get("4"); err != ErrNotFound {
+		t.Errorf("Store.Get() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		filter    Filter
+		wantIDs   []string
+		wantTotal int
+	}{
+		{name: "all", wantIDs: []string{"2", "3", "1"}, wantTotal: 3},
+		{name: "username", filter: Filter{Username: "oper"}, wantIDs: []string{"2", "3"}, wantTotal: 2},
+		{name: "name", filter: Filter{Name: "test"}, wantIDs: []string{"2", "1"}, wantTotal: 2},
+		{name: "operation", filter: Filter{Operation: "generate"}, wantIDs: []string{"1"}, wantTotal: 1},
+		{name: "status", filter: Filter{Status: StatusRunning}, wantIDs: []string{"2", "3"}, wantTotal: 2},
+		{name: "time", filter: Filter{From: start.Add(time.Minute), Until: start.Add(time.Hour)}, wantIDs: []string{"3"}, wantTotal: 1},
+		{name: "page", filter: Filter{Offset: 1, Limit: 1}, wantIDs: []string{"3"}, wantTotal: 3},
+		{name: "page end", filter: Filter{Offset: 3, Limit: 1}, wantIDs: []string{}, wantTotal: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, total := s.Query(tt.filter)
+			ids := make([]string, 0, len(jobs))
+			for _, j := range jobs {
+				ids = append(ids, j.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) || total != tt.wantTotal {
+				t.Errorf("Store.Query() = %v, %d, want %v, %d", ids, total, tt.wantIDs, tt.wantTotal)
+			}
+		})
+	}
+
+	// store is compacted on open
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(b, []byte{'\n'}); n != 3 {
+		t.Errorf("store lines = %d, want 3", n)
+	}
+}
+
+func TestStoreRecover(t *testing.T) {
+	file := path.Join(t.TempDir(), "jobs.jsonl")
+
+	s, err := Open(file, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+	job := Job{ID: "1", Name: "test", Operation: "failover", Username: "oper", Start: start, Status: StatusRunning, ExitCode: -1}
+	if err = s.Put(job); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// partially written on crash
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteString(`{"id":"1","name":"test","operation":"failover","status":"succ`); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if s, err = Open(file, Retention{}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Recovered() == nil {
+		t.Error("Store.Recovered() must return error for broken record")
+	}
+	if j, err := s.Get("1"); err != nil || !reflect.DeepEqual(j, job) {
+		t.Errorf("Store.Get() = %+v, %v", j, err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// broken record is removed on compaction
+	if s, err = Open(file, Retention{}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err = s.Recovered(); err != nil {
+		t.Errorf("Store.Recovered() = %v", err)
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	file := path.Join(t.TempDir(), "jobs.jsonl")
+	saved := compactMin
+	compactMin = 4
+	defer func() { compactMin = saved }()
+
+	s, err := Open(file, Retention{Keep: 2, MaxAge: time.Hour * 24 * 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+	now := time.Now().UTC()
+	for _, j := range []Job{
+		// running job is kept
+		{ID: "1", Start: now.Add(-time.Hour * 24 * 60), Status: StatusRunning},
+		// expired
+		{ID: "2", Start: now.Add(-time.Hour * 24 * 31), Status: StatusSuccess},
+		{ID: "3", Start: now.Add(-time.Hour * 3), Status: StatusFailed},
+		{ID: "4", Start: now.Add(-time.Hour * 2), Status: StatusSuccess},
+		{ID: "5", Start: now.Add(-time.Hour), Status: StatusSuccess},
+	} {
+		if err = s.Put(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if jobs, total := s.Query(Filter{}); total != 3 || jobs[0].ID != "5" || jobs[1].ID != "4" || jobs[2].ID != "1" {
+		t.Errorf("Store.Query() = %+v", jobs)
+	}
+
+	// store file is compacted, when stale records dominate
+	for i := 0; i < 20; i++ {
+		if err = s.Put(Job{ID: "5", Start: now.Add(-time.Hour), Status: StatusSuccess}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(b, []byte{'\n'}); n > 3+compactMin+1 {
+		t.Errorf("store file records = %d, must be compacted", n)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err = Open(file, Retention{Keep: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, total := s.Query(Filter{}); total != 2 || jobs[0].ID != "5" || jobs[1].ID != "1" {
+		t.Errorf("Store.Query() after reopen = %+v", jobs)
+	}
+}
@@ -0,0 +1,419 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+
+	"github.com/xrm-tech/xrm-controller/pkg/notify"
+)
+
+var (
+	ErrServerInvalid        = errors.New("mail server is invalid, must be host:port")
+	ErrTLSModeInvalid       = errors.New("mail tls mode is invalid, must be none, starttls or tls")
+	ErrFromInvalid          = errors.New("mail from address is invalid")
+	ErrRecipientsEmpty      = errors.New("mail recipients are empty")
+	ErrStartTLSNotSupported = errors.New("mail server not support STARTTLS")
+
+	// queueSize is a max pending messages, new events are dropped on overflow
+	queueSize = 100
+	// attempts is a send attempts for message
+	attempts   = 3
+	retryDelay = time.Second * 10
+)
+
+const (
+	TLSNone     = "none"
+	TLSStartTLS = "starttls"
+	TLSImplicit = "tls"
+
+	// ExcerptLines is a log excerpt size
+	ExcerptLines = 20
+
+	DefaultSubject = `[xrm-controller] {{.Operation}} {{.Name}} {{if .Result}}{{.Result}}{{else}}started{{end}}`
+	DefaultBody    = `Operation: {{.Operation}}
+Config: {{.Name}}
+User: {{.Username}}
+Time: {{.Time.Format "2006-01-02T15:04:05Z07:00"}}
+{{- if .Result}}
+Result: {{.Result}}
+Duration: {{printf "%.1f" .Duration}}s
+{{- end}}
+{{- if .Error}}
+Error: {{.Error}}
+{{- end}}
+{{if .Warnings}}
+Storages remap:
+{{range .Warnings}}  {{.}}
+{{end}}{{end}}
+{{- if .Log}}
+Log excerpt:
+{{range .Log}}  {{.}}
+{{end}}{{end}}`
+)
+
+// Recipients is a recipients for filtered events
+type Recipients struct {
+	To []string `json:"to"`
+	notify.Filter
+}
+
+// Config is a SMTP notifier config
+type Config struct {
+	// Server is SMTP server address (host:port)
+	Server string `json:"server"`
+	// TLS is none, starttls (default) or tls (implicit TLS, usually port 465)
+	TLS string `json:"tls,omitempty"`
+	// CA is a CA bundle file for server certificate verification (system roots if empty)
+	CA       string `json:"ca,omitempty"`
+	Username string `json:"username,omitempty"`
+	// Password can be set as secret reference (scheme:name)
+	Password    string        `json:"password,omitempty"`
+	PasswordRef string        `json:"password_ref,omitempty"`
+	From        string        `json:"from"`
+	Recipients  []Recipients  `json:"recipients"`
+	Subject     string        `json:"subject,omitempty"` // text/template, DefaultSubject if empty
+	Body        string        `json:"body,omitempty"`    // text/template, DefaultBody if empty
+	Timeout     time.Duration `json:"-"`
+}
+
+func (cfg *Config) Validate() error {
+	if host, port, err := net.SplitHostPort(cfg.Server); err != nil || host == "" || port == "" {
+		return ErrServerInvalid
+	}
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = TLSStartTLS
+	case TLSNone, TLSStartTLS, TLSImplicit:
+	default:
+		return ErrTLSModeInvalid
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return ErrFromInvalid
+	}
+	if len(cfg.Recipients) == 0 {
+		return ErrRecipientsEmpty
+	}
+	for _, r := range cfg.Recipients {
+		if len(r.To) == 0 {
+			return ErrRecipientsEmpty
+		}
+		for _, to := range r.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				return errors.New("mail recipient " + to + " is invalid")
+			}
+		}
+		if err := r.Filter.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadConfig load notifier config from JSON file
+func LoadConfig(file string) (cfg Config, err error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		return
+	}
+	err = cfg.Validate()
+	return
+}
+
+type message struct {
+	e  notify.Event
+	to []string
+}
+
+// Notifier send events by email (asynchronously)
+type Notifier struct {
+	cfg       Config
+	host      string
+	tlsConfig *tls.Config
+	subject   *template.Template
+	body      *template.Template
+	logger    zerolog.Logger
+
+	queue  chan message
+	lock   sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+	// ctx is cancelled, when Close deadline is exceeded (pending messages are dropped)
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var _ notify.Notifier = (*Notifier)(nil)
+
+func New(cfg Config, logger zerolog.Logger) (n *Notifier, err error) {
+	if err = cfg.Validate(); err != nil {
+		return
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second * 30
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = DefaultSubject
+	}
+	if cfg.Body == "" {
+		cfg.Body = DefaultBody
+	}
+	n = &Notifier{cfg: cfg, logger: logger, queue: make(chan message, queueSize)}
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+	n.host, _, _ = net.SplitHostPort(cfg.Server)
+	n.tlsConfig = &tls.Config{ServerName: n.host, MinVersion: tls.VersionTLS12}
+	if cfg.CA != "" {
+		b, err := os.ReadFile(cfg.CA)
+		if err != nil {
+			return nil, err
+		}
+		n.tlsConfig.RootCAs = x509.NewCertPool()
+		if !n.tlsConfig.RootCAs.AppendCertsFromPEM(b) {
+			return nil, errors.New("mail CA bundle is invalid")
+		}
+	}
+	if n.subject, err = template.New("subject").Parse(cfg.Subject); err != nil {
+		return nil, errors.New("mail subject template: " + err.Error())
+	}
+	if n.body, err = template.New("body").Parse(cfg.Body); err != nil {
+		return nil, errors.New("mail body template: " + err.Error())
+	}
+
+	n.wg.Add(1)
+	go n.run()
+
+	return n, nil
+}
+
+// Notify queue email for matched recipients
+func (n *Notifier) Notify(e notify.Event) {
+	var (
+		to   []string
+		seen map[string]bool // normalized addresses, same address can be matched by several recipients
+	)
+	for i := range n.cfg.Recipients {
+		if !n.cfg.Recipients[i].Match(&e) {
+			continue
+		}
+		for _, rcpt := range n.cfg.Recipients[i].To {
+			addr := rcpt
+			if a, err := mail.ParseAddress(rcpt); err == nil {
+				addr = a.Address
+			}
+			if seen[addr] {
+				continue
+			}
+			if seen == nil {
+				seen = make(map[string]bool)
+			}
+			seen[addr] = true
+			to = append(to, rcpt)
+		}
+	}
+	if len(to) == 0 {
+		return
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.closed {
+		return
+	}
+	select {
+	case n.queue <- message{e: e, to: to}:
+	default:
+		n.logger.Error().Str("logger", "mail").Str("event", e.Event).Str("name", e.Name).Msg("queue is full, event dropped")
+	}
+}
+
+// Close stop accept events and wait for pending messages, when ctx is done,
+// running send is interrupted and pending messages are dropped
+func (n *Notifier) Close(ctx context.Context) (err error) {
+	n.lock.Lock()
+	if n.closed {
+		n.lock.Unlock()
+		return nil
+	}
+	n.closed = true
+	close(n.queue)
+	n.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		n.cancel()
+		<-done
+	}
+	n.cancel()
+	return
+}
+
+// sleep return false, if interrupted by Close deadline
+func (n *Notifier) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-n.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (n *Notifier) dropped(m *message, attempts int, err error) {
+	n.logger.Error().Str("logger", "mail").Str("event", m.e.Event).Str("name", m.e.Name).
+		Strs("to", m.to).Int("attempts", attempts).AnErr("error", err).Msg("shutdown, message dropped")
+}
+
+func (n *Notifier) run() {
+	defer n.wg.Done()
+	for m := range n.queue {
+		if n.ctx.Err() != nil {
+			n.dropped(&m, 0, nil)
+			continue
+		}
+		msg, err := n.Render(&m.e, m.to)
+		if err != nil {
+			n.logger.Error().Str("logger", "mail").Str("event", m.e.Event).Err(err).Msg("render failed")
+			continue
+		}
+		for attempt := 1; ; attempt++ {
+			if err = n.send(m.to, msg); err == nil {
+				break
+			}
+			if n.ctx.Err() != nil {
+				n.dropped(&m, attempt, err)
+				break
+			}
+			if attempt >= attempts {
+				n.logger.Error().Str("logger", "mail").Str("event", m.e.Event).Str("name", m.e.Name).
+					Strs("to", m.to).Int("attempts", attempt).Err(err).Msg("send failed")
+				break
+			}
+			if !n.sleep(retryDelay) {
+				n.dropped(&m, attempt, err)
+				break
+			}
+		}
+	}
+}
+
+// Render render message (headers and body)
+func (n *Notifier) Render(e *notify.Event, to []string) ([]byte, error) {
+	var subject, body bytes.Buffer
+	if err := n.subject.Execute(&subject, e); err != nil {
+		return nil, err
+	}
+	if err := n.body.Execute(&body, e); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(body.Len() + 512)
+	buf.WriteString("From: " + n.cfg.From + "\r\n")
+	buf.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	// protect from headers injection
+	s := strings.NewReplacer("\r", " ", "\n", " ").Replace(subject.String())
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", s) + "\r\n")
+	buf.WriteString("Date: " + e.Time.Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("Message-ID: <" + e.ID + "@xrm-controller>\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+
+	return buf.Bytes(), nil
+}
+
+func (n *Notifier) send(to []string, msg []byte) (err error) {
+	dialer := net.Dialer{Timeout: n.cfg.Timeout}
+	var conn net.Conn
+	if n.cfg.TLS == TLSImplicit {
+		tlsDialer := tls.Dialer{NetDialer: &dialer, Config: n.tlsConfig}
+		conn, err = tlsDialer.DialContext(n.ctx, "tcp", n.cfg.Server)
+	} else {
+		conn, err = dialer.DialContext(n.ctx, "tcp", n.cfg.Server)
+	}
+	if err != nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Now().Add(n.cfg.Timeout))
+	// interrupt send on shutdown
+	sent := make(chan struct{})
+	defer close(sent)
+	go func() {
+		select {
+		case <-n.ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-sent:
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	defer c.Close()
+
+	if n.cfg.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return ErrStartTLSNotSupported
+		}
+		if err = c.StartTLS(n.tlsConfig); err != nil {
+			return
+		}
+	}
+	if n.cfg.Username != "" {
+		// PlainAuth refuse to send password over unencrypted connection (except localhost)
+		if err = c.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.host)); err != nil {
+			return
+		}
+	}
+	from, _ := mail.ParseAddress(n.cfg.From)
+	if err = c.Mail(from.Address); err != nil {
+		return
+	}
+	for _, rcpt := range to {
+		addr, _ := mail.ParseAddress(rcpt)
+		if err = c.Rcpt(addr.Address); err != nil {
+			return
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return
+	}
+	if _, err = w.Write(msg); err != nil {
+		_ = w.Close()
+		return
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+	return c.Quit()
+}
@@ -0,0 +1,205 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/xrm-tech/xrm-controller/pkg/notify"
+)
+
+// smtpServer is a minimal SMTP stand-in, store received messages
+type smtpServer struct {
+	ln       net.Listener
+	lock     sync.Mutex
+	auth     []string
+	rcpt     []string
+	messages []string
+	// fail first n transactions with 451
+	fail int
+}
+
+func newSmtpServer(t *testing.T) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) Close() {
+	_ = s.ln.Close()
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			_ = tp.PrintfLine("250-localhost")
+			_ = tp.PrintfLine("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH PLAIN"):
+			s.lock.Lock()
+			s.auth = append(s.auth, line[len("AUTH PLAIN "):])
+			s.lock.Unlock()
+			_ = tp.PrintfLine("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.lock.Lock()
+			fail := s.fail > 0
+			if fail {
+				s.fail--
+			}
+			s.lock.Unlock()
+			if fail {
+				_ = tp.PrintfLine("451 4.3.0 try again later")
+			} else {
+				_ = tp.PrintfLine("250 OK")
+			}
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.lock.Lock()
+			s.rcpt = append(s.rcpt, line[len("RCPT TO:"):])
+			s.lock.Unlock()
+			_ = tp.PrintfLine("250 OK")
+		case cmd == "DATA":
+			_ = tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			b, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.lock.Lock()
+			s.messages = append(s.messages, string(b))
+			s.lock.Unlock()
+			_ = tp.PrintfLine("250 OK")
+		case cmd == "QUIT":
+			_ = tp.PrintfLine("221 Bye")
+			return
+		default:
+			_ = tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want error
+	}{
+		{
+			cfg:  Config{Server: "localhost", From: "xrm@localhost", Recipients: []Recipients{{To: []string{"oper@localhost"}}}},
+			want: ErrServerInvalid,
+		},
+		{
+			cfg:  Config{Server: "localhost:25", TLS: "ssl", From: "xrm@localhost", Recipients: []Recipients{{To: []string{"oper@localhost"}}}},
+			want: ErrTLSModeInvalid,
+		},
+		{
+			cfg:  Config{Server: "localhost:25", From: "xrm", Recipients: []Recipients{{To: []string{"oper@localhost"}}}},
+			want: ErrFromInvalid,
+		},
+		{
+			cfg:  Config{Server: "localhost:25", From: "XRM <xrm@localhost>"},
+			want: ErrRecipientsEmpty,
+		},
+		{
+			cfg: Config{Server: "localhost:25", From: "XRM <xrm@localhost>", Recipients: []Recipients{{To: []string{"oper@localhost"}}}},
+		},
+	}
+	for i, tt := range tests {
+		if err := tt.cfg.Validate(); err != tt.want {
+			t.Errorf("[%d] Config.Validate() = %v, want %v", i, err, tt.want)
+		}
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	retryDelay = time.Millisecond * 10
+
+	srv := newSmtpServer(t)
+	defer srv.Close()
+	srv.fail = 1
+
+	n, err := New(Config{
+		Server:   srv.ln.Addr().String(),
+		TLS:      TLSNone,
+		Username: "xrm",
+		Password: "secret",
+		From:     "XRM <xrm@localhost>",
+		Recipients: []Recipients{
+			{To: []string{"dr@localhost"}},
+			{To: []string{"prod@localhost"}, Filter: notify.Filter{Configs: []string{"prod-*"}, Events: []string{"failover.completed"}}},
+			// duplicated addresses must be skipped
+			{To: []string{"DR <dr@localhost>", "prod@localhost"}, Filter: notify.Filter{Configs: []string{"prod-*"}, Events: []string{"failover.completed"}}},
+		},
+	}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.Notify(notify.Started("failover", "prod-1", "oper"))
+	e := notify.Completed("failover", "prod-1", "oper", time.Now(), []string{"storage nfs1 remapped to nfs2"}, errors.New("playbook failed"))
+	e.Log = []string{"TASK [ovirt.ovirt.disaster_recovery]", "fatal: [localhost]: FAILED!"}
+	n.Notify(e)
+	if err = n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// notify after close must be ignored
+	n.Notify(e)
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if len(srv.messages) != 2 {
+		t.Fatalf("messages = %d, want 2\n%q", len(srv.messages), srv.messages)
+	}
+	wantRcpt := []string{"<dr@localhost>", "<dr@localhost>", "<prod@localhost>"}
+	if strings.Join(srv.rcpt, ",") != strings.Join(wantRcpt, ",") {
+		t.Errorf("rcpt = %q, want %q", srv.rcpt, wantRcpt)
+	}
+	if len(srv.auth) == 0 {
+		t.Error("auth not used")
+	}
+
+	// SMTP stand-in normalize line endings
+	msg := srv.messages[1]
+	for _, want := range []string{
+		"From: XRM <xrm@localhost>\n",
+		"To: dr@localhost, prod@localhost\n",
+		"Subject: [xrm-controller] failover prod-1 failed\n",
+		"Content-Type: text/plain; charset=utf-8\n",
+		"User: oper\n",
+		"Error: playbook failed\n",
+		"Storages remap:\n  storage nfs1 remapped to nfs2\n",
+		"  storage nfs1 remapped to nfs2\n\nLog excerpt:\n  TASK [ovirt.ovirt.disaster_recovery]\n  fatal: [localhost]: FAILED!\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message not contain %q\n%s", want, msg)
+		}
+	}
+	if !strings.Contains(srv.messages[0], "Subject: [xrm-controller] failover prod-1 started\n") {
+		t.Errorf("started message\n%s", srv.messages[0])
+	}
+}
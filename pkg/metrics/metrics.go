@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "xrm"
+
+var (
+	// Registry is a controller metrics registry (with go runtime and process metrics)
+	Registry = prometheus.NewRegistry()
+
+	// operation runs (generate, failover, failback, cleanup) by config and outcome (success, failed, busy)
+	operations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operations_total",
+		Help:      "Operations runs by config and outcome.",
+	}, []string{"operation", "name", "outcome"})
+
+	operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "operation_duration_seconds",
+		Help:      "Operations duration by config and outcome.",
+		Buckets:   durationBuckets,
+	}, []string{"operation", "name", "outcome"})
+
+	playbookDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "playbook_duration_seconds",
+		Help:      "Ansible playbooks duration by config and outcome.",
+		Buckets:   durationBuckets,
+	}, []string{"operation", "name", "outcome"})
+
+	lockContention = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lock_contention_total",
+		Help:      "Operations rejected, because another operation in progress.",
+	}, []string{"operation"})
+
+	inFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "operations_in_flight",
+		Help:      "Operations in progress.",
+	}, []string{"operation"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP requests latencies by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+
+	lastGenerate = &lastSuccessCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "generate_last_success_age_seconds"),
+			"Time since last successful generate by config.",
+			[]string{"name"}, nil,
+		),
+		last: make(map[string]time.Time),
+	}
+
+	// playbooks can run for minutes
+	durationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200}
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		operations, operationDuration, playbookDuration, lockContention, inFlight, httpDuration, lastGenerate,
+	)
+}
+
+// lastSuccessCollector report time since last success by config
+type lastSuccessCollector struct {
+	desc *prometheus.Desc
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func (c *lastSuccessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *lastSuccessCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for name, t := range c.last {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, now.Sub(t).Seconds(), name)
+	}
+}
+
+func (c *lastSuccessCollector) set(name string, t time.Time) {
+	c.mu.Lock()
+	c.last[name] = t
+	c.mu.Unlock()
+}
+
+func (c *lastSuccessCollector) delete(name string) {
+	c.mu.Lock()
+	delete(c.last, name)
+	c.mu.Unlock()
+}
+
+// ObserveOperation record operation run for config, outcome is success, failed or busy (rejected, another operation in progress)
+func ObserveOperation(operation, name, outcome string, start time.Time) {
+	name = strings.Clone(name) // label values are stored, but caller strings can be reused (fiber params)
+	operations.WithLabelValues(operation, name, outcome).Inc()
+	operationDuration.WithLabelValues(operation, name, outcome).Observe(time.Since(start).Seconds())
+	if outcome == "busy" {
+		lockContention.WithLabelValues(operation).Inc()
+	} else if outcome == "success" && operation == "generate" {
+		lastGenerate.set(name, time.Now())
+	}
+}
+
+// ObservePlaybook record playbook run for config
+func ObservePlaybook(operation, name, outcome string, start time.Time) {
+	name = strings.Clone(name)
+	playbookDuration.WithLabelValues(operation, name, outcome).Observe(time.Since(start).Seconds())
+}
+
+// Started increment in-flight operations, returned func must be called on operation end
+func Started(operation string) (done func()) {
+	g := inFlight.WithLabelValues(operation)
+	g.Inc()
+	return g.Dec
+}
+
+// ObserveHTTP record HTTP request latency
+func ObserveHTTP(method, route string, code int, start time.Time) {
+	httpDuration.WithLabelValues(method, route, strconv.Itoa(code)).Observe(time.Since(start).Seconds())
+}
+
+// Deleted remove config metrics (after config delete)
+func Deleted(name string) {
+	labels := prometheus.Labels{"name": name}
+	operations.DeletePartialMatch(labels)
+	operationDuration.DeletePartialMatch(labels)
+	playbookDuration.DeletePartialMatch(labels)
+	lastGenerate.delete(name)
+}
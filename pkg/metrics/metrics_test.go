@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveOperation(t *testing.T) {
+	start := time.Now()
+	ObserveOperation("generate", "test", "success", start)
+	ObserveOperation("failover", "test", "busy", start)
+	ObserveOperation("failover", "test2", "failed", start)
+	ObservePlaybook("generate", "test", "success", start)
+
+	if n := testutil.ToFloat64(operations.WithLabelValues("failover", "test", "busy")); n != 1 {
+		t.Errorf("operations{failover,test,busy} = %v, want 1", n)
+	}
+	if n := testutil.ToFloat64(lockContention.WithLabelValues("failover")); n != 1 {
+		t.Errorf("lock_contention{failover} = %v, want 1", n)
+	}
+	if n := testutil.CollectAndCount(lastGenerate); n != 1 {
+		t.Errorf("generate_last_success_age_seconds count = %d, want 1", n)
+	}
+
+	done := Started("failover")
+	if n := testutil.ToFloat64(inFlight.WithLabelValues("failover")); n != 1 {
+		t.Errorf("operations_in_flight{failover} = %v, want 1", n)
+	}
+	done()
+	if n := testutil.ToFloat64(inFlight.WithLabelValues("failover")); n != 0 {
+		t.Errorf("operations_in_flight{failover} = %v, want 0", n)
+	}
+
+	Deleted("test")
+	if n := testutil.CollectAndCount(operations); n != 1 {
+		t.Errorf("operations count after delete = %d, want 1", n)
+	}
+	if n := testutil.CollectAndCount(playbookDuration); n != 0 {
+		t.Errorf("playbook_duration_seconds count after delete = %d, want 0", n)
+	}
+	if n := testutil.CollectAndCount(lastGenerate); n != 0 {
+		t.Errorf("generate_last_success_age_seconds count after delete = %d, want 0", n)
+	}
+
+	if _, err := Registry.Gather(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/xrm-tech/xrm-controller/pkg/utils"
+)
+
+var (
+	ErrPatternInvalid = errors.New("config pattern is invalid")
+)
+
+type Result string
+
+const (
+	ResultSuccess Result = "success"
+	ResultFailed  Result = "failed"
+)
+
+// Event is an operation lifecycle event, Event is {operation}.started or {operation}.completed
+type Event struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	Operation string    `json:"operation"`
+	Name      string    `json:"name"`
+	Username  string    `json:"username"`
+	Time      time.Time `json:"time"`
+	Duration  float64   `json:"duration,omitempty"` // seconds, for completed
+	Result    Result    `json:"result,omitempty"`   // for completed
+	Error     string    `json:"error,omitempty"`
+	Warnings  []string  `json:"warnings,omitempty"`
+	// Log is an operation output excerpt (last lines), not sent to webhooks
+	Log []string `json:"-"`
+}
+
+// Started return operation started event
+func Started(operation, name, username string) Event {
+	return Event{
+		ID:        newID(),
+		Event:     operation + ".started",
+		Operation: operation,
+		Name:      name,
+		Username:  username,
+		Time:      time.Now().UTC(),
+	}
+}
+
+// Completed return operation completed event
+func Completed(operation, name, username string, start time.Time, warnings []string, err error) Event {
+	e := Event{
+		ID:        newID(),
+		Event:     operation + ".completed",
+		Operation: operation,
+		Name:      name,
+		Username:  username,
+		Time:      time.Now().UTC(),
+		Duration:  time.Since(start).Seconds(),
+		Result:    ResultSuccess,
+		Warnings:  warnings,
+	}
+	if err != nil {
+		e.Result = ResultFailed
+		e.Error = err.Error()
+	}
+	return e
+}
+
+func newID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Excerpt return last n not empty lines of output, lines which can contain secrets are redacted
+func Excerpt(out string, n int) []string {
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	excerpt := make([]string, 0, n)
+	for i := len(lines) - 1; i >= 0 && len(excerpt) < n; i-- {
+		if lines[i] == "" {
+			continue
+		}
+		excerpt = append(excerpt, utils.Redact(lines[i]))
+	}
+	// reverse to output order
+	for i, j := 0, len(excerpt)-1; i < j; i, j = i+1, j-1 {
+		excerpt[i], excerpt[j] = excerpt[j], excerpt[i]
+	}
+	return excerpt
+}
+
+// Filter is an events filter
+type Filter struct {
+	// Configs is a config name patterns (path.Match syntax), all configs if empty
+	Configs []string `json:"configs,omitempty"`
+	// Events is a events filter (like failover.started or failover for all failover events), all events if empty
+	Events []string `json:"events,omitempty"`
+}
+
+func (f *Filter) Validate() error {
+	for _, pattern := range f.Configs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return ErrPatternInvalid
+		}
+	}
+	return nil
+}
+
+func (f *Filter) Match(e *Event) bool {
+	if len(f.Configs) > 0 {
+		matched := false
+		for _, pattern := range f.Configs {
+			if ok, _ := path.Match(pattern, e.Name); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(f.Events) > 0 {
+		for _, event := range f.Events {
+			if event == e.Event || event == e.Operation {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Notifier send events (asynchronously)
+type Notifier interface {
+	Notify(e Event)
+	// Close stop accept events and wait for pending deliveries,
+	// pending deliveries are dropped (and logged) when ctx is done
+	Close(ctx context.Context) error
+}
+
+// Notifiers send events to all notifiers
+type Notifiers []Notifier
+
+func (n Notifiers) Notify(e Event) {
+	for _, notifier := range n {
+		notifier.Notify(e)
+	}
+}
+
+// Close close all notifiers, ctx bound the whole wait
+func (n Notifiers) Close(ctx context.Context) (err error) {
+	for _, notifier := range n {
+		if closeErr := notifier.Close(ctx); err == nil {
+			err = closeErr
+		}
+	}
+	return
+}
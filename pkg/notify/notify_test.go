@@ -0,0 +1,25 @@
+package notify
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		out  string
+		n    int
+		want []string
+	}{
+		{out: "", n: 2, want: []string{}},
+		{out: "a\nb\n\nc\n", n: 2, want: []string{"b", "c"}},
+		{out: "a\nb\n", n: 5, want: []string{"a", "b"}},
+		{out: "a\nengine_password: pwd\nc", n: 3, want: []string{"a", "[redacted]", "c"}},
+		{out: "Token: abc\nc", n: 3, want: []string{"[redacted]", "c"}},
+	}
+	for i, tt := range tests {
+		if got := Excerpt(tt.out, tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("[%d] Excerpt(%q, %d) = %q, want %q", i, tt.out, tt.n, got, tt.want)
+		}
+	}
+}
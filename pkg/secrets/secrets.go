@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrRefInvalid      = errors.New("secret reference is invalid (scheme:name)")
+	ErrSchemeNotFound  = errors.New("secret scheme not supported")
+	ErrNameInvalid     = errors.New("secret name is invalid")
+	ErrNotFound        = errors.New("secret not found")
+	ErrStoreKeyInvalid = errors.New("secrets store key is empty")
+
+	nameRe = regexp.MustCompile(`^[a-zA-Z_\-0-9.]+$`)
+
+	// EnvPrefix is a prefix for env variables, available with env: scheme
+	EnvPrefix = "XRM_SECRET_"
+)
+
+// ValidateName check secret name (also protect from path traversal)
+func ValidateName(name string) bool {
+	return name != "." && name != ".." && nameRe.MatchString(name)
+}
+
+// Provider resolve secret name (reference without scheme) to secret value
+type Provider interface {
+	Get(name string) (string, error)
+}
+
+// Resolver resolve secret references (scheme:name) with registered providers
+type Resolver map[string]Provider
+
+// Resolve return secret value for reference (scheme:name)
+func (r Resolver) Resolve(ref string) (string, error) {
+	scheme, name, ok := strings.Cut(ref, ":")
+	if !ok || scheme == "" || name == "" {
+		return "", ErrRefInvalid
+	}
+	p, ok := r[scheme]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSchemeNotFound, scheme)
+	}
+	return p.Get(name)
+}
+
+// FileProvider read secret from file in dir (trailing newline is stripped)
+type FileProvider struct {
+	Dir string
+}
+
+func (p FileProvider) Get(name string) (string, error) {
+	if !ValidateName(name) {
+		return "", ErrNameInvalid
+	}
+	b, err := os.ReadFile(path.Join(p.Dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%w: file:%s", ErrNotFound, name)
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// EnvProvider read secret from env variable {EnvPrefix}{name}
+type EnvProvider struct{}
+
+func (EnvProvider) Get(name string) (string, error) {
+	if !ValidateName(name) {
+		return "", ErrNameInvalid
+	}
+	v, ok := os.LookupEnv(EnvPrefix + name)
+	if !ok {
+		return "", fmt.Errorf("%w: env:%s", ErrNotFound, name)
+	}
+	return v, nil
+}
@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = os.WriteFile(path.Join(dir, "engine1"), []byte("file_secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvPrefix+"ENGINE1", "env_secret")
+
+	store, err := NewStore(path.Join(dir, "store"), []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Set("engine1", "store_secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := Resolver{"file": FileProvider{Dir: dir}, "env": EnvProvider{}, "store": store}
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{ref: "file:engine1", want: "file_secret"},
+		{ref: "file:engine2", wantErr: ErrNotFound},
+		{ref: "file:../engine1", wantErr: ErrNameInvalid},
+		{ref: "env:ENGINE1", want: "env_secret"},
+		{ref: "env:ENGINE2", wantErr: ErrNotFound},
+		{ref: "store:engine1", want: "store_secret"},
+		{ref: "store:engine2", wantErr: ErrNotFound},
+		{ref: "vault:engine1", wantErr: ErrSchemeNotFound},
+		{ref: "engine1", wantErr: ErrRefInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := r.Resolve(tt.ref)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolver.Resolve() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolver.Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewStore(dir, []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b", "a"} {
+		if err = store.Set(name, "secret_"+name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if names, err := store.List(); err != nil || !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Fatalf("Store.List() = %v, %v", names, err)
+	}
+
+	// stored encrypted
+	b, err := os.ReadFile(path.Join(dir, "a.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(b, []byte("secret_a")) {
+		t.Fatal("secret stored unencrypted")
+	}
+
+	// another key
+	store2, err := NewStore(dir, []byte("key2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store2.Get("a"); err != ErrSecretCorrupted {
+		t.Fatalf("Store.Get() with another key error = %v", err)
+	}
+
+	// renamed secret
+	if err = os.Rename(path.Join(dir, "b.enc"), path.Join(dir, "c.enc")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Get("c"); err != ErrSecretCorrupted {
+		t.Fatalf("Store.Get() for renamed secret error = %v", err)
+	}
+
+	if err = store.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Get("a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Store.Get() for deleted secret error = %v", err)
+	}
+}
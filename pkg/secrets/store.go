@@ -0,0 +1,116 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrSecretCorrupted = errors.New("secret is corrupted or encrypted with another key")
+
+	storeExt = ".enc"
+)
+
+// Store is a local secrets store, each secret is encrypted (AES-256-GCM) in {dir}/{name}.enc
+type Store struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+// NewStore open secrets store in dir, encryption key is derived from passphrase (SHA-256)
+func NewStore(dir string, passphrase []byte) (*Store, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrStoreKeyInvalid
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(passphrase)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, aead: aead}, nil
+}
+
+func (s *Store) Get(name string) (string, error) {
+	if !ValidateName(name) {
+		return "", ErrNameInvalid
+	}
+	b, err := os.ReadFile(path.Join(s.dir, name+storeExt))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%w: store:%s", ErrNotFound, name)
+		}
+		return "", err
+	}
+	nonceSize := s.aead.NonceSize()
+	if len(b) < nonceSize {
+		return "", ErrSecretCorrupted
+	}
+	// name is used as additional data, so encrypted secret can't be renamed
+	v, err := s.aead.Open(nil, b[:nonceSize], b[nonceSize:], []byte(name))
+	if err != nil {
+		return "", ErrSecretCorrupted
+	}
+	return string(v), nil
+}
+
+// Set encrypt and save secret
+func (s *Store) Set(name, value string) error {
+	if !ValidateName(name) {
+		return ErrNameInvalid
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	b := s.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+
+	// write to temporary file and rename for not corrupt secret on failure
+	file := path.Join(s.dir, name+storeExt)
+	tmpFile := file + ".tmp"
+	if err := os.WriteFile(tmpFile, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+func (s *Store) Delete(name string) error {
+	if !ValidateName(name) {
+		return ErrNameInvalid
+	}
+	err := os.Remove(path.Join(s.dir, name+storeExt))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: store:%s", ErrNotFound, name)
+	}
+	return err
+}
+
+// List return sorted secrets names
+func (s *Store) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), storeExt) {
+			names = append(names, strings.TrimSuffix(e.Name(), storeExt))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"time"
+)
+
+// Cert is a generated certificate/key pair (in PEM)
+type Cert struct {
+	Cert []byte
+	Key  []byte
+
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// WriteFiles write certificate and key to {dir}/{name}.crt and {dir}/{name}.key
+func (c *Cert) WriteFiles(dir, name string) (certFile, keyFile string, err error) {
+	certFile = path.Join(dir, name+".crt")
+	keyFile = path.Join(dir, name+".key")
+	if err = os.WriteFile(certFile, c.Cert, 0644); err != nil {
+		return
+	}
+	err = os.WriteFile(keyFile, c.Key, 0600)
+	return
+}
+
+// GenerateCert generate certificate, signed by ca (self-signed CA if ca is nil)
+func GenerateCert(ca *Cert, commonName string, isClient bool) (*Cert, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"xrm-controller tests"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	parent := template
+	parentKey := key
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		parent = ca.cert
+		parentKey = ca.key
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		if isClient {
+			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		} else {
+			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+			template.DNSNames = []string{"localhost"}
+			template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cert{
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		cert: cert,
+		key:  key,
+	}, nil
+}
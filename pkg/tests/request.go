@@ -0,0 +1,21 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+func DoRequest(method, request, username, password string, wantStatus int) ([]byte, error) {
+	req, _ := http.NewRequest(method, request, nil)
+	req.SetBasicAuth(username, password)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s error = %v", request, err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != wantStatus || err != nil {
+		return body, fmt.Errorf("%s = %d (%s), error is %v", request, resp.StatusCode, string(body), err)
+	}
+	return body, nil
+}
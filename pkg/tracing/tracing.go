@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrExporterInvalid = errors.New("trace exporter is invalid, must be none, otlp or file")
+	ErrFileEmpty       = errors.New("trace file is empty")
+
+	tracerName = "github.com/xrm-tech/xrm-controller"
+	provider   *sdktrace.TracerProvider
+	file       *os.File
+)
+
+// Config is a tracing exporter config
+type Config struct {
+	// Exporter is none (tracing disabled), otlp (OTLP over HTTP) or file (JSON lines, for offline environments)
+	Exporter string
+	// Endpoint is OTLP collector address (host:port), if empty, OTEL_EXPORTER_OTLP_* environment variables are used
+	Endpoint string
+	// Insecure disable TLS for OTLP collector
+	Insecure bool
+	// File is spans file for file exporter
+	File    string
+	Version string
+}
+
+// Init setup global tracer provider, must be called before spans start
+func Init(cfg Config) (err error) {
+	var exporter sdktrace.SpanExporter
+
+	switch cfg.Exporter {
+	case "", "none":
+		return nil
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if exporter, err = otlptracehttp.New(context.Background(), opts...); err != nil {
+			return
+		}
+	case "file":
+		if cfg.File == "" {
+			return ErrFileEmpty
+		}
+		if file, err = os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640); err != nil {
+			return
+		}
+		if exporter, err = stdouttrace.New(stdouttrace.WithWriter(file)); err != nil {
+			_ = file.Close()
+			return
+		}
+	default:
+		return ErrExporterInvalid
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName("xrm-controller"),
+			semconv.ServiceVersion(cfg.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return nil
+}
+
+// Shutdown flush spans and stop exporter
+func Shutdown(ctx context.Context) (err error) {
+	if provider != nil {
+		err = provider.Shutdown(ctx)
+		provider = nil
+	}
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		file = nil
+	}
+	return
+}
+
+// Tracer return controller tracer (noop if tracing is disabled)
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Start start span
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// End set span error status (if err is not nil) and end span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -4,33 +4,81 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	// DefaultMaxOutput is a default in-memory output size (only tail is kept, full output is in log file)
+	DefaultMaxOutput = 4 * 1024 * 1024
+	// DefaultMaxLineLen is a default max line length, longer lines are truncated
+	DefaultMaxLineLen = 1024 * 1024
+
+	// LogTimeFormat is a log file line timestamp format
+	LogTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+	// StderrPrefix is a prefix for stderr lines in log file
+	StderrPrefix = "[stderr] "
+
+	readBufferSize = 64 * 1024
+)
+
+// waitDelay is a max output read time after command is killed (on timeout or cancel),
+// output pipes can be kept open by command childs (like ssh ControlPersist master)
+var waitDelay = time.Second * 5
+
+// Cmd is a command with output to log file
+type Cmd struct {
+	Command string
+	Args    []string
+	// Env is a command environment (current process environment if nil)
+	Env []string
+	// OutFile is a log file (previous is renamed to .old), lines are prefixed with timestamp (and StderrPrefix for stderr)
+	OutFile string
+	Timeout time.Duration
+	// OnStart (if not nil) is called with process id after command start
+	OnStart func(pid int)
+	// OnLine (if not nil) is called for each stdout and stderr line (in arrival order) while command is running
+	OnLine func(line string)
+	// MaxOutput is a max returned output size (last lines are kept), DefaultMaxOutput if 0
+	MaxOutput int
+	// MaxLineLen is a max line length, DefaultMaxLineLen if 0
+	MaxLineLen int
+}
+
 func ExecCmd(outFile string, timeout time.Duration, command string, args ...string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	c := Cmd{Command: command, Args: args, OutFile: outFile, Timeout: timeout}
+	return c.Run(context.Background())
+}
+
+// Run run command, return output (tail, if output is larger than MaxOutput)
+func (c *Cmd) Run(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, command, args...)
-	out, err := cmd.StdoutPipe()
+	cmd := exec.CommandContext(ctx, c.Command, c.Args...)
+	cmd.Env = c.Env
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return "", err
 	}
-	outErr, err := cmd.StderrPipe()
+	stderr, err := cmd.StderrPipe()
 	if err != nil {
 		return "", err
 	}
 
-	if FileExists(outFile) {
-		if err := os.Rename(outFile, outFile+".old"); err != nil {
+	if FileExists(c.OutFile) {
+		if err := os.Rename(c.OutFile, c.OutFile+".old"); err != nil {
 			return "", err
 		}
 	}
 
-	f, err := os.OpenFile(outFile, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
+	f, err := os.OpenFile(c.OutFile, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
 	if err != nil {
 		return "", err
 	}
@@ -41,28 +89,172 @@ func ExecCmd(outFile string, timeout time.Duration, command string, args ...stri
 	if err = cmd.Start(); err != nil {
 		return "", err
 	}
+	if c.OnStart != nil {
+		c.OnStart(cmd.Process.Pid)
+	}
 
-	var outBuf bytes.Buffer
-
-	scanner := bufio.NewScanner(out)
-	for scanner.Scan() {
-		b := scanner.Bytes()
-		outBuf.Write(b)
-		outBuf.WriteByte('\n')
-		_, _ = f.Write(b)
-		_, _ = f.Write([]byte{'\n'})
+	maxOutput := c.MaxOutput
+	if maxOutput <= 0 {
+		maxOutput = DefaultMaxOutput
 	}
+	maxLineLen := c.MaxLineLen
+	if maxLineLen <= 0 {
+		maxLineLen = DefaultMaxLineLen
+	}
+
+	var (
+		lock     sync.Mutex
+		tail     = TailBuffer{Max: maxOutput}
+		wg       sync.WaitGroup
+		readErrs [2]error
+		writeErr error
+		logLine  []byte
+	)
+	// lines from stdout and stderr are processed under lock, so order is kept and OnLine is not called concurrently
+	processLine := func(line []byte, truncated int, isStderr bool) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if truncated > 0 {
+			line = append(line, " ... [truncated "+strconv.Itoa(truncated)+" bytes]"...)
+		}
+		logLine = time.Now().AppendFormat(logLine[:0], LogTimeFormat)
+		logLine = append(logLine, ' ')
+		if isStderr {
+			logLine = append(logLine, StderrPrefix...)
+		}
+		logLine = append(logLine, line...)
+		logLine = append(logLine, '\n')
+		if _, err := f.Write(logLine); err != nil && writeErr == nil {
+			writeErr = err
+		}
 
-	scanner = bufio.NewScanner(outErr)
-	for scanner.Scan() {
-		b := scanner.Bytes()
-		outBuf.Write(b)
-		outBuf.WriteByte('\n')
-		_, _ = f.Write(b)
-		_, _ = f.Write([]byte{'\n'})
+		s := string(line)
+		tail.Add(s)
+		if c.OnLine != nil {
+			c.OnLine(s)
+		}
 	}
 
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		readErrs[0] = ReadLines(stdout, maxLineLen, func(line []byte, truncated int) { processLine(line, truncated, false) })
+	}()
+	go func() {
+		defer wg.Done()
+		readErrs[1] = ReadLines(stderr, maxLineLen, func(line []byte, truncated int) { processLine(line, truncated, true) })
+	}()
+	// close pipes, if output is not closed after command kill (go 1.19 has no exec.Cmd.WaitDelay)
+	readDone := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-readDone:
+			return
+		}
+		select {
+		case <-time.After(waitDelay):
+			_ = stdout.Close()
+			_ = stderr.Close()
+		case <-readDone:
+		}
+	}()
+	// all reads must be completed before Wait
+	wg.Wait()
+	close(readDone)
+
 	err = cmd.Wait()
+	if err == nil {
+		if readErrs[0] != nil {
+			err = errors.New("read stdout: " + readErrs[0].Error())
+		} else if readErrs[1] != nil {
+			err = errors.New("read stderr: " + readErrs[1].Error())
+		} else if writeErr != nil {
+			err = errors.New("write " + c.OutFile + ": " + writeErr.Error())
+		}
+	}
+
+	return tail.String(), err
+}
+
+// ReadLines read lines (without line ending) from r, lines longer than maxLen are truncated (truncated bytes count is passed to fn)
+func ReadLines(r io.Reader, maxLen int, fn func(line []byte, truncated int)) error {
+	br := bufio.NewReaderSize(r, readBufferSize)
+	var (
+		line      []byte
+		truncated int
+	)
+	add := func(frag []byte) {
+		n := maxLen - len(line)
+		if n > len(frag) {
+			n = len(frag)
+		}
+		line = append(line, frag[:n]...)
+		truncated += len(frag) - n
+	}
+	for {
+		frag, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			add(frag)
+			continue
+		}
+		if len(frag) > 0 || len(line) > 0 || truncated > 0 {
+			frag = bytes.TrimSuffix(frag, []byte{'\n'})
+			add(frag)
+			fn(bytes.TrimSuffix(line, []byte{'\r'}), truncated)
+			line = line[:0]
+			truncated = 0
+		}
+		if err != nil {
+			if err == io.EOF || errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+	}
+}
 
-	return outBuf.String(), err
+// TailBuffer keep last lines with total size up to Max (at least one line is kept)
+type TailBuffer struct {
+	Max     int
+	lines   []string
+	start   int
+	size    int
+	dropped int
+}
+
+func (b *TailBuffer) Add(line string) {
+	b.lines = append(b.lines, line)
+	b.size += len(line) + 1
+	for b.size > b.Max && b.start < len(b.lines)-1 {
+		b.size -= len(b.lines[b.start]) + 1
+		b.lines[b.start] = ""
+		b.start++
+		b.dropped++
+	}
+	// compact dropped lines
+	if b.start > 1024 && b.start > len(b.lines)/2 {
+		n := copy(b.lines, b.lines[b.start:])
+		b.lines = b.lines[:n]
+		b.start = 0
+	}
+}
+
+// Dropped return dropped lines count
+func (b *TailBuffer) Dropped() int {
+	return b.dropped
+}
+
+func (b *TailBuffer) String() string {
+	var buf strings.Builder
+	buf.Grow(b.size + 64)
+	if b.dropped > 0 {
+		buf.WriteString("... [" + strconv.Itoa(b.dropped) + " lines truncated, see log]\n")
+	}
+	for _, line := range b.lines[b.start:] {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.String()
 }
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCmd_Run(t *testing.T) {
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outFile := path.Join(dir, "out.log")
+
+	// streams are merged in arrival order
+	var lines []string
+	c := Cmd{
+		Command: "sh", Args: []string{"-c", "echo out1; sleep 0.05; echo err1 >&2; sleep 0.05; echo out2"},
+		OutFile: outFile, Timeout: time.Second * 10,
+		OnLine: func(line string) { lines = append(lines, line) },
+	}
+	out, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "out1\nerr1\nout2\n" {
+		t.Errorf("Cmd.Run() = %q", out)
+	}
+	if strings.Join(lines, ",") != "out1,err1,out2" {
+		t.Errorf("Cmd.Run() lines = %q", lines)
+	}
+	b, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logLines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(logLines) != 4 {
+		t.Fatalf("log = %q", logLines)
+	}
+	for i, want := range []string{"out1", StderrPrefix + "err1", "out2"} {
+		ts, s, _ := strings.Cut(logLines[i+1], " ")
+		if _, err := time.Parse(LogTimeFormat, ts); err != nil {
+			t.Errorf("log line %d timestamp: %v", i+1, err)
+		}
+		if s != want {
+			t.Errorf("log line %d = %q, want %q", i+1, s, want)
+		}
+	}
+
+	// chatty stderr (larger than pipe buffer) must not block stdout
+	c = Cmd{
+		Command: "sh", Args: []string{"-c", "i=0; while [ $i -lt 5000 ]; do echo stderr line $i >&2; i=$((i+1)); done; echo done"},
+		OutFile: outFile, Timeout: time.Second * 10,
+	}
+	if out, err = c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// stdout and stderr are read concurrently, so only lines count is checked
+	if !strings.Contains("\n"+out, "\ndone\n") || strings.Count(out, "\n") != 5001 {
+		t.Errorf("Cmd.Run() lines = %d", strings.Count(out, "\n"))
+	}
+	if !FileExists(outFile + ".old") {
+		t.Error("previous log not renamed")
+	}
+
+	// long lines are truncated, only tail is kept in memory
+	c = Cmd{
+		Command: "sh", Args: []string{"-c", "head -c 100000 /dev/zero | tr '\\0' 'x'; echo; seq 1 1000"},
+		OutFile: outFile, Timeout: time.Second * 10,
+		MaxOutput: 100, MaxLineLen: 1000,
+	}
+	if out, err = c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "... [") || !strings.HasSuffix(out, "\n999\n1000\n") || len(out) > 150 {
+		t.Errorf("Cmd.Run() = %q", out)
+	}
+	if b, err = os.ReadFile(outFile); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), strings.Repeat("x", 1000)+" ... [truncated 99000 bytes]\n") {
+		t.Error("long line is not truncated in log")
+	}
+
+	// exit code
+	c = Cmd{Command: "sh", Args: []string{"-c", "echo failed; exit 2"}, OutFile: outFile, Timeout: time.Second * 10}
+	if out, err = c.Run(context.Background()); err == nil || err.Error() != "exit status 2" || out != "failed\n" {
+		t.Errorf("Cmd.Run() = %q, %v", out, err)
+	}
+
+	// timeout with output pipes, kept open by command child
+	saved := waitDelay
+	waitDelay = time.Millisecond * 100
+	defer func() { waitDelay = saved }()
+	c = Cmd{Command: "sh", Args: []string{"-c", "sleep 3 & echo started; sleep 3"}, OutFile: outFile, Timeout: time.Millisecond * 200}
+	start := time.Now()
+	if out, err = c.Run(context.Background()); err == nil || out != "started\n" {
+		t.Errorf("Cmd.Run() = %q, %v", out, err)
+	}
+	if d := time.Since(start); d > time.Second*2 {
+		t.Errorf("Cmd.Run() with timeout completed in %v", d)
+	}
+}
+
+type errReader struct {
+	data string
+	err  error
+}
+
+func (r *errReader) Read(b []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestReadLines(t *testing.T) {
+	var lines []string
+	fn := func(line []byte, truncated int) {
+		lines = append(lines, string(line)+"/"+strconv.Itoa(truncated))
+	}
+
+	if err := ReadLines(strings.NewReader("a\r\n\nbcdef\nlast"), 3, fn); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a/0,/0,bcd/2,las/1"; strings.Join(lines, ",") != want {
+		t.Errorf("ReadLines() = %q, want %q", lines, want)
+	}
+
+	lines = lines[:0]
+	readErr := errors.New("read failed")
+	if err := ReadLines(&errReader{data: "a\nb", err: readErr}, 10, fn); err != readErr {
+		t.Errorf("ReadLines() = %v, want %v", err, readErr)
+	}
+	if want := "a/0,b/0"; strings.Join(lines, ",") != want {
+		t.Errorf("ReadLines() = %q, want %q", lines, want)
+	}
+
+	lines = lines[:0]
+	if err := ReadLines(&errReader{err: io.EOF}, 10, fn); err != nil || len(lines) != 0 {
+		t.Errorf("ReadLines() = %q, %v", lines, err)
+	}
+}
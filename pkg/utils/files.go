@@ -27,3 +27,13 @@ func TouchFile(fileName string) error {
 	}
 	return file.Close()
 }
+
+// DirWritable check dir is writable (with temporary file create)
+func DirWritable(dirName string) error {
+	file, err := os.CreateTemp(dirName, ".writable")
+	if err != nil {
+		return err
+	}
+	_ = file.Close()
+	return os.Remove(file.Name())
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// ProcessRunning check process is running and it's command line contain match (command line is checked only if /proc is available)
+func ProcessRunning(pid int, match string) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if err = p.Signal(syscall.Signal(0)); err != nil && !errors.Is(err, syscall.EPERM) {
+		return false
+	}
+	if !DirExists("/proc/self") {
+		return true
+	}
+	cmdline, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if err != nil {
+		return false
+	}
+	return match == "" || bytes.Contains(cmdline, []byte(match))
+}
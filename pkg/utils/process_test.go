@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestProcessRunning(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 30; :", "xrm-controller-test")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = cmd.Process.Kill() }()
+	pid := cmd.Process.Pid
+
+	if !ProcessRunning(pid, "") {
+		t.Error("ProcessRunning() = false")
+	}
+	if !ProcessRunning(pid, "xrm-controller-test") {
+		t.Error("ProcessRunning(match) = false")
+	}
+	if DirExists("/proc/self") && ProcessRunning(pid, "xrm-controller-other") {
+		t.Error("ProcessRunning(mismatch) = true")
+	}
+	if ProcessRunning(0, "") || ProcessRunning(-1, "") {
+		t.Error("ProcessRunning(invalid pid) = true")
+	}
+
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+	if ProcessRunning(pid, "") {
+		t.Error("ProcessRunning() after exit = true")
+	}
+	if !ProcessRunning(os.Getpid(), "") {
+		t.Error("ProcessRunning(self) = false")
+	}
+}
@@ -1,6 +1,12 @@
 package utils
 
-import "unsafe"
+import (
+	"strings"
+	"unsafe"
+)
+
+// redactMarkers is a markers for strings, which can contain secrets
+var redactMarkers = []string{"password", "token", "secret"}
 
 // UnsafeString returns the string under byte buffer
 func UnsafeString(b []byte) string {
@@ -25,3 +31,14 @@ func Clone(s string) string {
 	copy(b, s)
 	return UnsafeString(b)
 }
+
+// Redact return "[redacted]" if s can contain secrets (password, token or secret in any case)
+func Redact(s string) string {
+	lower := strings.ToLower(s)
+	for _, marker := range redactMarkers {
+		if strings.Contains(lower, marker) {
+			return "[redacted]"
+		}
+	}
+	return s
+}
@@ -1,5 +1,29 @@
 package utils
 
+import (
+	"errors"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrControlChars = errors.New("contain control characters")
+	ErrUrlInvalid   = errors.New("not a valid url")
+	ErrUrlNotHttps  = errors.New("scheme must be https")
+	ErrUrlUserinfo  = errors.New("credentials in url are not allowed")
+	ErrUrlQuery     = errors.New("query and fragment are not allowed")
+	ErrHostInvalid  = errors.New("not a valid IP address or hostname")
+	ErrPortInvalid  = errors.New("port is invalid")
+	ErrPathNotAbs   = errors.New("path must be absolute")
+	ErrPathNotClean = errors.New("path must be clean (without . or .. elements and duplicate slashes)")
+	ErrValueTooLong = errors.New("value is too long")
+)
+
 type IError struct {
 	Field  string
 	Reason string
@@ -10,3 +34,85 @@ type ValidateStatus struct {
 	Message string
 	Fields  []IError
 }
+
+// MaxValueLen is a max length for single line values (urls, hosts, paths, usernames)
+const MaxValueLen = 1024
+
+// HasControlChars check for control characters (newline and others can inject vars into generated files)
+func HasControlChars(s string) bool {
+	for _, r := range s {
+		if unicode.IsControl(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateLine check single line value
+func ValidateLine(s string) error {
+	if len(s) > MaxValueLen {
+		return ErrValueTooLong
+	}
+	if HasControlChars(s) {
+		return ErrControlChars
+	}
+	return nil
+}
+
+var hostnameRe = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9\-_]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9\-_]{0,61}[a-zA-Z0-9])?\.?$`)
+
+// ValidateHost check for IP address or hostname (RFC 1123, underscores are also allowed)
+func ValidateHost(host string) error {
+	if len(host) > 253 {
+		return ErrHostInvalid
+	}
+	if net.ParseIP(host) != nil || hostnameRe.MatchString(host) {
+		return nil
+	}
+	return ErrHostInvalid
+}
+
+// ValidateHttpsUrl check for https url without credentials, query and fragment
+func ValidateHttpsUrl(s string) error {
+	if err := ValidateLine(s); err != nil {
+		return err
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return ErrUrlInvalid
+	}
+	if u.Scheme != "https" {
+		return ErrUrlNotHttps
+	}
+	if u.User != nil {
+		return ErrUrlUserinfo
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.ForceQuery {
+		return ErrUrlQuery
+	}
+	host := u.Hostname()
+	if err = ValidateHost(host); err != nil {
+		return err
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return ErrPortInvalid
+		}
+	}
+	return nil
+}
+
+// ValidateAbsPath check for clean absolute path
+func ValidateAbsPath(s string) error {
+	if err := ValidateLine(s); err != nil {
+		return err
+	}
+	if !path.IsAbs(s) {
+		return ErrPathNotAbs
+	}
+	// trailing slash is allowed
+	if s != "/" && path.Clean(s) != strings.TrimRight(s, "/") {
+		return ErrPathNotClean
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+
+	"github.com/xrm-tech/xrm-controller/pkg/notify"
+)
+
+var (
+	ErrUrlInvalid = errors.New("webhook url is invalid")
+
+	// queueSize is a max pending deliveries per hook, new events are dropped on overflow
+	queueSize = 100
+)
+
+const (
+	// SignatureHeader contain HMAC-SHA256 of request body (sha256=<hex>), if hook secret is set
+	SignatureHeader = "X-XRM-Signature"
+	EventHeader     = "X-XRM-Event"
+	DeliveryHeader  = "X-XRM-Delivery"
+)
+
+// Hook is a webhook endpoint
+type Hook struct {
+	URL string `json:"url"`
+	// HMAC key for request signature, can be set as secret reference (scheme:name)
+	Secret    string `json:"secret,omitempty"`
+	SecretRef string `json:"secret_ref,omitempty"`
+	notify.Filter
+}
+
+func (h *Hook) Validate() error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrUrlInvalid
+	}
+	return h.Filter.Validate()
+}
+
+// LoadHooks load hooks list from JSON file
+func LoadHooks(file string) ([]Hook, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var hooks []Hook
+	if err = json.Unmarshal(b, &hooks); err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		if err = hooks[i].Validate(); err != nil {
+			return nil, errors.New(err.Error() + ": " + hooks[i].URL)
+		}
+	}
+	return hooks, nil
+}
+
+// Sign return request signature (sha256=<hex HMAC-SHA256 of body>)
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Delivery is a delivery log record (one per attempt)
+type Delivery struct {
+	Time     time.Time `json:"time"`
+	ID       string    `json:"id"` // event id
+	Event    string    `json:"event"`
+	Name     string    `json:"name"`
+	URL      string    `json:"url"`
+	Attempt  int       `json:"attempt"`
+	Code     int       `json:"code,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Duration float64   `json:"duration"` // seconds
+}
+
+// Config is a dispatcher config
+type Config struct {
+	Timeout time.Duration
+	// Retries is a retries count for failed delivery (network errors, 429 and 5xx responses)
+	Retries int
+	// Backoff is a delay before first retry, doubled for next retries (up to MaxBackoff)
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// LogFile is a delivery log (JSON lines), disabled if empty
+	LogFile string
+	Logger  zerolog.Logger
+}
+
+var _ notify.Notifier = (*Dispatcher)(nil)
+
+type worker struct {
+	hook  Hook
+	queue chan notify.Event
+}
+
+// Dispatcher send events to hooks (asynchronously, in order for each hook)
+type Dispatcher struct {
+	cfg     Config
+	client  *http.Client
+	workers []*worker
+
+	lock    sync.Mutex
+	logFile *os.File
+	closed  bool
+	wg      sync.WaitGroup
+	// ctx is cancelled, when Close deadline is exceeded (pending deliveries are dropped)
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func New(hooks []Hook, cfg Config) (*Dispatcher, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second * 10
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.Backoff {
+		cfg.MaxBackoff = cfg.Backoff
+	}
+	d := &Dispatcher{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	if cfg.LogFile != "" {
+		var err error
+		if d.logFile, err = os.OpenFile(cfg.LogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640); err != nil {
+			return nil, err
+		}
+	}
+	for _, hook := range hooks {
+		w := &worker{hook: hook, queue: make(chan notify.Event, queueSize)}
+		d.workers = append(d.workers, w)
+		d.wg.Add(1)
+		go d.run(w)
+	}
+	return d, nil
+}
+
+// Notify queue event for matched hooks
+func (d *Dispatcher) Notify(e notify.Event) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.closed {
+		return
+	}
+	for _, w := range d.workers {
+		if !w.hook.Match(&e) {
+			continue
+		}
+		select {
+		case w.queue <- e:
+		default:
+			d.cfg.Logger.Error().Str("logger", "webhook").Str("url", w.hook.URL).Str("event", e.Event).Str("name", e.Name).Msg("queue is full, event dropped")
+		}
+	}
+}
+
+// Close stop accept events and wait for pending deliveries, when ctx is done,
+// running deliveries are interrupted and pending deliveries are dropped
+func (d *Dispatcher) Close(ctx context.Context) (err error) {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return nil
+	}
+	d.closed = true
+	for _, w := range d.workers {
+		close(w.queue)
+	}
+	d.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		d.cancel()
+		<-done
+	}
+	d.cancel()
+
+	if d.logFile != nil {
+		if closeErr := d.logFile.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return
+}
+
+func (d *Dispatcher) run(w *worker) {
+	defer d.wg.Done()
+	for e := range w.queue {
+		if d.ctx.Err() != nil {
+			d.dropped(&w.hook, &e, 0, nil)
+			continue
+		}
+		d.deliver(&w.hook, &e)
+	}
+}
+
+// sleep return false, if interrupted by Close deadline
+func (d *Dispatcher) sleep(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-d.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (d *Dispatcher) dropped(hook *Hook, e *notify.Event, attempts int, err error) {
+	d.cfg.Logger.Error().Str("logger", "webhook").Str("url", hook.URL).Str("event", e.Event).Str("name", e.Name).
+		Int("attempts", attempts).AnErr("error", err).Msg("shutdown, delivery dropped")
+}
+
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// deliver send event with retries
+func (d *Dispatcher) deliver(hook *Hook, e *notify.Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		d.cfg.Logger.Error().Str("logger", "webhook").Str("event", e.Event).Err(err).Msg("event encode failed")
+		return
+	}
+
+	backoff := d.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		code, err := d.send(hook, e, body)
+		d.log(Delivery{
+			Time: start.UTC(), ID: e.ID, Event: e.Event, Name: e.Name, URL: hook.URL,
+			Attempt: attempt, Code: code, Error: errString(err), Duration: time.Since(start).Seconds(),
+		})
+		if err == nil {
+			return
+		}
+		if d.ctx.Err() != nil {
+			d.dropped(hook, e, attempt, err)
+			return
+		}
+		if attempt > d.cfg.Retries || (code != 0 && !retryable(code)) {
+			d.cfg.Logger.Error().Str("logger", "webhook").Str("url", hook.URL).Str("event", e.Event).Str("name", e.Name).
+				Int("attempts", attempt).Err(err).Msg("delivery failed")
+			return
+		}
+		if !d.sleep(backoff) {
+			d.dropped(hook, e, attempt, err)
+			return
+		}
+		if backoff *= 2; backoff > d.cfg.MaxBackoff {
+			backoff = d.cfg.MaxBackoff
+		}
+	}
+}
+
+func (d *Dispatcher) send(hook *Hook, e *notify.Event, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, e.Event)
+	req.Header.Set(DeliveryHeader, e.ID)
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.New("response status " + strconv.Itoa(resp.StatusCode))
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) log(r Delivery) {
+	if d.logFile == nil {
+		return
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+	d.lock.Lock()
+	_, err = d.logFile.Write(b)
+	d.lock.Unlock()
+	if err != nil {
+		d.cfg.Logger.Error().Str("logger", "webhook").Err(err).Msg("delivery log write failed")
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Deliveries return last delivery log records (all if limit is 0)
+func (d *Dispatcher) Deliveries(limit int) ([]Delivery, error) {
+	deliveries := make([]Delivery, 0)
+	if d.cfg.LogFile == "" {
+		return deliveries, nil
+	}
+	f, err := os.Open(d.cfg.LogFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return deliveries, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Delivery
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// skip partially written record
+			continue
+		}
+		deliveries = append(deliveries, r)
+		if limit > 0 && len(deliveries) > limit {
+			deliveries = deliveries[1:]
+		}
+	}
+	return deliveries, scanner.Err()
+}
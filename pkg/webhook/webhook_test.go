@@ -0,0 +1,141 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+
+	"github.com/xrm-tech/xrm-controller/pkg/notify"
+)
+
+func TestHook_Match(t *testing.T) {
+	tests := []struct {
+		hook Hook
+		e    notify.Event
+		want bool
+	}{
+		{hook: Hook{}, e: notify.Started("failover", "test", "oper"), want: true},
+		{hook: Hook{Filter: notify.Filter{Configs: []string{"prod-*"}}}, e: notify.Started("failover", "prod-1", "oper"), want: true},
+		{hook: Hook{Filter: notify.Filter{Configs: []string{"prod-*"}}}, e: notify.Started("failover", "test", "oper"), want: false},
+		{hook: Hook{Filter: notify.Filter{Events: []string{"failover"}}}, e: notify.Started("failover", "test", "oper"), want: true},
+		{hook: Hook{Filter: notify.Filter{Events: []string{"failover.completed"}}}, e: notify.Started("failover", "test", "oper"), want: false},
+		{hook: Hook{Filter: notify.Filter{Events: []string{"failover.completed"}}}, e: notify.Completed("failover", "test", "oper", time.Now(), nil, nil), want: true},
+	}
+	for i, tt := range tests {
+		if got := tt.hook.Match(&tt.e); got != tt.want {
+			t.Errorf("[%d] Hook.Match(%q, %q) = %v, want %v", i, tt.e.Event, tt.e.Name, got, tt.want)
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	dir, err := os.MkdirTemp("", "xrm-controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		lock     sync.Mutex
+		requests int
+		events   []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get(SignatureHeader); got != Sign("secret", body) {
+			t.Errorf("signature = %q", got)
+		}
+		if requests == 1 {
+			// retried
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e notify.Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Error(err)
+		}
+		events = append(events, e.Event+" "+e.Name+" "+string(e.Result)+" "+e.Error)
+	}))
+	defer srv.Close()
+
+	d, err := New(
+		[]Hook{{URL: srv.URL, Secret: "secret", Filter: notify.Filter{Configs: []string{"test*"}}}, {URL: srv.URL + "/bad", Filter: notify.Filter{Configs: []string{"none"}}}},
+		Config{Retries: 2, Backoff: time.Millisecond, LogFile: path.Join(dir, "webhooks.log")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	d.Notify(notify.Started("failover", "test", "oper"))
+	d.Notify(notify.Started("failover", "other", "oper"))
+	d.Notify(notify.Completed("failover", "test", "oper", start, nil, errors.New("exit status 2")))
+	if err = d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	wantEvents := []string{"failover.started test  ", "failover.completed test failed exit status 2"}
+	if !reflect.DeepEqual(events, wantEvents) {
+		t.Errorf("events = %q, want %q", events, wantEvents)
+	}
+
+	deliveries, err := d.Deliveries(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []int
+	for _, r := range deliveries {
+		codes = append(codes, r.Code)
+	}
+	if want := []int{503, 200, 200}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("deliveries codes = %v, want %v", codes, want)
+	}
+	if deliveries, err = d.Deliveries(1); err != nil || len(deliveries) != 1 || deliveries[0].Event != "failover.completed" {
+		t.Errorf("Dispatcher.Deliveries(1) = %+v, %v", deliveries, err)
+	}
+}
+
+func TestDispatcher_CloseDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	d, err := New([]Hook{{URL: srv.URL}}, Config{Retries: 5, Backoff: time.Hour, Logger: zerolog.New(&buf)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		d.Notify(notify.Started("failover", "test", "oper"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err = d.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Dispatcher.Close() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Dispatcher.Close() wait %v, backoff must be interrupted", elapsed)
+	}
+	// first delivery interrupted in backoff, other pending are dropped without attempts
+	if n := strings.Count(buf.String(), "shutdown, delivery dropped"); n != 3 {
+		t.Errorf("dropped deliveries logged %d times, want 3\n%s", n, buf.String())
+	}
+}